@@ -17,7 +17,7 @@
 // Package glog implements logging analogous to the Google-internal C++ INFO/ERROR/V setup.
 // It provides functions that have a name matched by regex:
 //
-//	(Info|Warning|Error|Fatal)(Context)?(Depth)?(f)?
+//	(Info|Warning|Error|Fatal)(Context)?(Depth)?(f|S)?
 //
 // If Context is present, function takes context.Context argument. The
 // context is used to pass through the Trace Context to log sinks that can make use
@@ -34,6 +34,10 @@
 //
 // If 'f' is present, function formats according to a format specifier.
 //
+// If 'S' is present, function takes a message followed by alternating keys and
+// values. Sinks that accept structured data receive the pairs as typed values;
+// text log output renders them after the message as key="value".
+//
 // This package also provides V-style logging controlled by the -v and -vmodule=file=2 flags.
 //
 // Basic examples:
@@ -42,6 +46,8 @@
 //
 //	glog.Fatalf("Initialization failed: %s", err)
 //
+//	glog.InfoS("Request served", "path", req.URL.Path, "status", 200)
+//
 // See the documentation for the V function for an explanation of these examples:
 //
 //	if glog.V(2) {
@@ -51,7 +57,8 @@
 //	glog.V(2).Infoln("Processed", nItems, "elements")
 //
 // Log output is buffered and written periodically using Flush. Programs
-// should call Flush before exiting to guarantee all log output is written.
+// should call Flush before exiting to guarantee all log output is written,
+// or Shutdown to also close the log files.
 //
 // By default, all log statements write to files in a temporary directory.
 // This package provides several flags that modify this behavior.
@@ -66,7 +73,164 @@
 //		error as well as to files.
 //	-log_dir=""
 //		Log files will be written to this directory instead of the
-//		default temporary directory.
+//		default temporary directory.  It may be a list of directories,
+//		separated as in $PATH, of which the first one in which log files
+//		can be created is used, with the temporary directory as the last
+//		resort.  If the directory of the current log files stops being
+//		writable, logging moves on to the next one within
+//		-log_flush_interval, and a line recording the switch is written
+//		to both the old and the new files.
+//	-log_dir_create=false
+//		Create the -log_dir directories that do not exist, with the mode
+//		set by -log_file_mode.
+//	-log_file=""
+//		If non-empty, log entries of all severities are appended to
+//		this single file instead of being written to per-severity files
+//		in the log directory.  When the file reaches MaxSize bytes, it is
+//		renamed by adding the next free number, such as app.log.3, and
+//		started anew.  -log_file_severities, -one_output and the
+//		templates below do not apply, and the retention flags count the
+//		numbered files as a single severity.
+//	-log_file_severities=INFO,WARNING,ERROR,FATAL
+//		The severities whose log files are written.  A log entry is
+//		written to the files of its severity and of all lower ones in
+//		this list, so "INFO,ERROR" writes two files, the second of which
+//		holds only ERROR and FATAL entries.
+//	-one_output=false
+//		Write each log entry to a single file: that of its severity, or
+//		of the nearest lower severity in -log_file_severities.  This
+//		avoids writing the same entry to several files.
+//	-log_file_template="{program}.{host}.{user}.log.{tag}.{YYYY}{MM}{DD}-{hh}{mm}{ss}.{pid}"
+//		The names of log files, relative to the log directory.  The
+//		placeholders {program}, {host}, {user}, {tag} (the severity),
+//		{pid} and {env:NAME} (the environment variable NAME) are replaced
+//		with their values, and {YYYY}, {MM}, {DD}, {hh}, {mm} and {ss}
+//		with the time at which the file is created.  {seq} is replaced
+//		with the number of files previously created for the severity,
+//		and is incremented until the name is not already taken.  The
+//		template must contain {tag}, and {seq} or all the time
+//		placeholders so that new log files get new names.  It may
+//		contain '/' to place log files in subdirectories, which are
+//		created as needed.
+//	-log_link_template="{program}.{tag}"
+//		The names of the symbolic links to the latest log files, in the
+//		log directory and in -log_link.  The placeholders are those of
+//		-log_file_template, except for the time and {seq}.  Templates
+//		that could give a symlink the name of a log file are rejected.
+//		Symlinks are replaced atomically, and the first failure to
+//		update one is logged as a WARNING.
+//	-log_latest_link=false
+//		Also maintain a symlink named program.log to the latest log file
+//		created, whatever its severity.
+//	-log_link_targets=""
+//		How symlinks refer to log files: "relative" to the directory of
+//		the symlink, or "absolute".  By default, the symlinks in the log
+//		directory are relative and those in -log_link use the path of the
+//		log file as derived from -log_dir.
+//	-log_file_mode=""
+//		If non-empty, the octal permission bits, such as 0640, given to
+//		new log files regardless of the umask.  Directories created for
+//		log files get the same bits, plus search permission wherever
+//		read permission is granted.
+//	-log_file_group=""
+//		If non-empty, the name or numeric id of the group given to new
+//		log files, their directories and symlinks.  A failure to set the
+//		mode or group of a new file is reported as a failure to write
+//		it, according to -log_sink_error_policy.
+//	-log_disk_full_keep=ERROR
+//		While the disk holding the log files is full, entries below this
+//		severity are dropped instead of failing, and one of them is
+//		written every 10 seconds to detect when space becomes available
+//		again.  A line recording the number of entries and bytes dropped
+//		is then written to each log file.  Stats.DiskFullDropped counts
+//		them too.
+//	-log_disk_reserve=0
+//		If positive, reserve this many bytes in each log directory, in a
+//		hidden file that is deleted when the disk becomes full, to make
+//		room for the entries kept by -log_disk_full_keep.  The file,
+//		.program.log_reserve, is reused by later runs of the program.
+//	-log_compress=""
+//		If "gzip", compress each log file in the background once it
+//		has been rotated, and remove the original.  The "Next log" and
+//		"Previous log" lines then name the files as they will be once
+//		compressed.  SetCompressor selects other compressors.
+//	-log_max_files=0
+//	-log_max_age=0
+//	-log_max_total_size=0
+//		If positive, old log files of this program are deleted in the
+//		background after each rotation: those beyond the newest
+//		-log_max_files of each severity, those older than -log_max_age,
+//		and the oldest ones while the total size of the program's files
+//		in the directory exceeds -log_max_total_size bytes.  Only files
+//		named by -log_file_template for this program, host and user, and
+//		its -log_flight_recorder_size files, counted as a severity of
+//		their own, are considered; the current files and the targets of
+//		their symlinks are kept.
+//	-log_rotate_interval=""
+//		If non-empty, also start new log files at every multiple of this
+//		interval since midnight: "hourly", "daily", or a duration
+//		between 1m and 24h such as "15m".  A file is rotated by its first
+//		write after the boundary.  The "Next log" and "Previous log"
+//		lines chain the files as for rotation by size.
+//	-log_rotate_timezone=Local
+//		The time zone (such as "UTC") in which -log_rotate_interval is
+//		aligned to midnight.
+//	-log_flush_interval=30s
+//		The interval at which buffered log entries are written to the
+//		log files.  Entries above -logbuflevel (WARNING and above by
+//		default) are written immediately.
+//	-log_sync_severity=NONE
+//		Log entries at or above this severity, such as ERROR, are written
+//		to the log files and synced to disk (with fsync) before the
+//		logging call returns, so that they survive a crash of the
+//		process or machine.  Other entries are still buffered.
+//	-log_flight_recorder_size=0
+//		If positive, also write every log entry, whatever its severity
+//		and the other output flags, to a file named
+//		program.host.user.flight.YYYYMMDD-hhmmss.pid in the log
+//		directory.  The file is mapped into memory and used as a ring of
+//		this many bytes, overwriting the oldest entries, so that the
+//		latest ones reach it even if the process is killed before
+//		buffered entries are flushed.  (A crash of the machine may still
+//		lose them.)  DecodeFlightRecorder turns the file back into glog
+//		text.  Shutdown unmaps the file, and RestartFileSink starts a
+//		new one.  Unix only.
+//	-log_detect_rotation=false
+//		Check every -log_flush_interval whether the log files have been
+//		moved, deleted or truncated by another program, such as
+//		logrotate with its copytruncate option, and if so reopen them by
+//		name.  Reopen and ReopenOnSignal do the same on demand.
+//	-log_format=glog
+//		The format of log entries written to files and standard error:
+//		"glog" for the classic text format, or "json" for one JSON
+//		object per line.  SetFileFormatter and SetStderrFormatter
+//		override it.
+//	-log_header_format=""
+//		The format of the header at the start of each log file, which
+//		records the build, command line, changed glog flags, pid and
+//		start time of the process, and lines added with AddFileHeader:
+//		"text" for one "Key: value" line each, or "json" for a single
+//		JSON object.  By default, it is "json" if log entries are written
+//		to files as JSON and "text" otherwise.
+//	-log_multiline=raw
+//		How to write log entries that span several lines, such as those
+//		with a backtrace: "raw" writes them as they are, with a header
+//		on the first line only; "prefix" repeats the header on every
+//		line; "escape" encodes newlines as \n so that each entry is a
+//		single line.
+//	-log_escape_control_chars=false
+//		Escape control characters (including newlines), terminal escape
+//		sequences and invalid UTF-8 in log messages, so that messages
+//		containing user-supplied strings cannot forge log entries or
+//		take over a terminal.
+//	-log_sink_error_policy=abort
+//		What to do when writing to a log sink (such as a log file) fails:
+//		"abort" logs a FATAL message and terminates the process; "disable"
+//		stops writing to the sink and reports the failure once to the
+//		others; "stderr" does the same but also writes all log entries to
+//		standard error; "retry" stops writing to the sink for an interval
+//		that doubles with each consecutive failure.  SetSinkErrorHandler
+//		can be used to observe failures.
 //
 // Other flags provide aids to debugging.
 //
@@ -146,6 +310,15 @@ func (s *OutputStats) Bytes() int64 {
 // per severity level. Values must be read with atomic.LoadInt64.
 var Stats struct {
 	Info, Warning, Error OutputStats
+
+	// AsyncDropped counts the entries (and, for an AsyncTextSink, the bytes)
+	// dropped by asynchronous sinks because their queues were full.
+	AsyncDropped OutputStats
+
+	// DiskFullDropped counts the entries and bytes dropped by the file sink
+	// because the disk was full (see -log_disk_full_keep).  Bytes that were
+	// buffered when the disk became full are counted without their entries.
+	DiskFullDropped OutputStats
 }
 
 var severityStats = [...]*OutputStats{
@@ -191,6 +364,8 @@ func appendBacktrace(depth int, format string, args []any) (string, []any) {
 	dump := stackdump.Caller(depth)
 
 	// Add an arg and an entry in the format string for the stack dump.
+	// (The logsink package recognizes this suffix to keep the stack dump at the
+	// end of text entries that have key/value pairs.)
 	//
 	// Copy the "args" slice to avoid a rare but serious aliasing bug
 	// (corrupting the caller's slice if they passed it to a non-Fatal call
@@ -209,6 +384,18 @@ func logf(depth int, severity logsink.Severity, verbose bool, stack stack, forma
 // ctxlogf writes a log message for a log function call (or log function wrapper)
 // at the given depth in the current goroutine's stack.
 func ctxlogf(ctx context.Context, depth int, severity logsink.Severity, verbose bool, stack stack, format string, args ...any) {
+	ctxlogkvf(ctx, depth+1, severity, verbose, stack, nil, format, args...)
+}
+
+// ctxlogs acts as ctxlogf, but logs msg followed by the alternating keys and
+// values in kv.
+func ctxlogs(ctx context.Context, depth int, severity logsink.Severity, verbose bool, stack stack, msg string, kv []any) {
+	ctxlogkvf(ctx, depth+1, severity, verbose, stack, kv, "%s", msg)
+}
+
+// ctxlogkvf acts as ctxlogf, but also passes kv to the sinks as
+// logsink.Meta.KeysAndValues.
+func ctxlogkvf(ctx context.Context, depth int, severity logsink.Severity, verbose bool, stack stack, kv []any, format string, args ...any) {
 	now := timeNow()
 	_, file, line, ok := runtime.Caller(depth + 1)
 	if !ok {
@@ -230,11 +417,14 @@ func ctxlogf(ctx context.Context, depth int, severity logsink.Severity, verbose
 		Severity: severity,
 		Verbose:  verbose,
 		Thread:   int64(pid),
+
+		KeysAndValues: kv,
 	}
 	sinkf(meta, format, args...)
 	// Clear pointer fields so they can be garbage collected early.
 	meta.Context = nil
 	meta.Stack = nil
+	meta.KeysAndValues = nil
 	metaPool.Put(metai)
 }
 
@@ -249,23 +439,29 @@ func sinkf(meta *logsink.Meta, format string, args ...any) {
 	}
 
 	if err != nil {
-		// Best-effort to generate a reasonable Fatalf-like
-		// error message in all sinks that are still here for
-		// the first goroutine that comes here and terminate
-		// the process.
-		sinkErrOnce.Do(func() {
-			m := &logsink.Meta{}
-			m.Time = timeNow()
-			m.Severity = logsink.Fatal
-			m.Thread = int64(pid)
-			_, m.File, m.Line, _ = runtime.Caller(0)
-			format, args := appendBacktrace(1, "log: exiting because of error writing previous log to sinks: %v", []any{err})
-			logsink.Printf(m, format, args...)
-			flushAndAbort()
-		})
+		handleSinkError(err)
 	}
 }
 
+// abortForSinkError logs a FATAL message about err, which was returned by a
+// sink, and terminates the process.
+func abortForSinkError(err error) {
+	// Best-effort to generate a reasonable Fatalf-like
+	// error message in all sinks that are still here for
+	// the first goroutine that comes here and terminate
+	// the process.
+	sinkErrOnce.Do(func() {
+		m := &logsink.Meta{}
+		m.Time = timeNow()
+		m.Severity = logsink.Fatal
+		m.Thread = int64(pid)
+		_, m.File, m.Line, _ = runtime.Caller(0)
+		format, args := appendBacktrace(1, "log: exiting because of error writing previous log to sinks: %v", []any{err})
+		logsink.Printf(m, format, args...)
+		flushAndAbort()
+	})
+}
+
 // CopyStandardLogTo arranges for messages written to the Go "log" package's
 // default logs to also appear in the Google logs for the named and lower
 // severities.  Subsequent changes to the standard log's default output location
@@ -489,6 +685,38 @@ func (v Verbose) InfoContextDepthf(ctx context.Context, depth int, format string
 	}
 }
 
+// InfoS is equivalent to the global InfoS function, guarded by the value of v.
+// See the documentation of V for usage.
+func (v Verbose) InfoS(msg string, keysAndValues ...any) {
+	if v {
+		ctxlogs(nil, 1, logsink.Info, true, noStack, msg, keysAndValues)
+	}
+}
+
+// InfoDepthS is equivalent to the global InfoDepthS function, guarded by the value of v.
+// See the documentation of V for usage.
+func (v Verbose) InfoDepthS(depth int, msg string, keysAndValues ...any) {
+	if v {
+		ctxlogs(nil, depth+1, logsink.Info, true, noStack, msg, keysAndValues)
+	}
+}
+
+// InfoContextS is equivalent to the global InfoContextS function, guarded by the value of v.
+// See the documentation of V for usage.
+func (v Verbose) InfoContextS(ctx context.Context, msg string, keysAndValues ...any) {
+	if v {
+		ctxlogs(ctx, 1, logsink.Info, true, noStack, msg, keysAndValues)
+	}
+}
+
+// InfoContextDepthS is equivalent to the global InfoContextDepthS function, guarded by the value of v.
+// See the documentation of V for usage.
+func (v Verbose) InfoContextDepthS(ctx context.Context, depth int, msg string, keysAndValues ...any) {
+	if v {
+		ctxlogs(ctx, depth+1, logsink.Info, true, noStack, msg, keysAndValues)
+	}
+}
+
 // Info logs to the INFO log.
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Info(args ...any) {
@@ -545,6 +773,30 @@ func InfoContextDepthf(ctx context.Context, depth int, format string, args ...an
 	ctxlogf(ctx, depth+1, logsink.Info, false, noStack, format, args...)
 }
 
+// InfoS logs msg and the alternating keys and values in keysAndValues to the INFO log.
+// Text output renders the pairs after msg as key="value".
+func InfoS(msg string, keysAndValues ...any) {
+	ctxlogs(nil, 1, logsink.Info, false, noStack, msg, keysAndValues)
+}
+
+// InfoDepthS acts as InfoS but uses depth to determine which call frame to log.
+// InfoDepthS(0, "msg") is the same as InfoS("msg").
+func InfoDepthS(depth int, msg string, keysAndValues ...any) {
+	ctxlogs(nil, depth+1, logsink.Info, false, noStack, msg, keysAndValues)
+}
+
+// InfoContextS is like [InfoS], but with an extra [context.Context] parameter. The
+// context is used to pass the Trace Context to log sinks.
+func InfoContextS(ctx context.Context, msg string, keysAndValues ...any) {
+	ctxlogs(ctx, 1, logsink.Info, false, noStack, msg, keysAndValues)
+}
+
+// InfoContextDepthS is like [InfoDepthS], but with an extra [context.Context] parameter. The
+// context is used to pass the Trace Context to log sinks.
+func InfoContextDepthS(ctx context.Context, depth int, msg string, keysAndValues ...any) {
+	ctxlogs(ctx, depth+1, logsink.Info, false, noStack, msg, keysAndValues)
+}
+
 // Warning logs to the WARNING and INFO logs.
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Warning(args ...any) {
@@ -599,6 +851,30 @@ func WarningContextDepthf(ctx context.Context, depth int, format string, args ..
 	ctxlogf(ctx, depth+1, logsink.Warning, false, noStack, format, args...)
 }
 
+// WarningS logs msg and the alternating keys and values in keysAndValues to the WARNING and INFO logs.
+// Text output renders the pairs after msg as key="value".
+func WarningS(msg string, keysAndValues ...any) {
+	ctxlogs(nil, 1, logsink.Warning, false, noStack, msg, keysAndValues)
+}
+
+// WarningDepthS acts as WarningS but uses depth to determine which call frame to log.
+// WarningDepthS(0, "msg") is the same as WarningS("msg").
+func WarningDepthS(depth int, msg string, keysAndValues ...any) {
+	ctxlogs(nil, depth+1, logsink.Warning, false, noStack, msg, keysAndValues)
+}
+
+// WarningContextS is like [WarningS], but with an extra [context.Context] parameter. The
+// context is used to pass the Trace Context to log sinks.
+func WarningContextS(ctx context.Context, msg string, keysAndValues ...any) {
+	ctxlogs(ctx, 1, logsink.Warning, false, noStack, msg, keysAndValues)
+}
+
+// WarningContextDepthS is like [WarningDepthS], but with an extra [context.Context] parameter. The
+// context is used to pass the Trace Context to log sinks.
+func WarningContextDepthS(ctx context.Context, depth int, msg string, keysAndValues ...any) {
+	ctxlogs(ctx, depth+1, logsink.Warning, false, noStack, msg, keysAndValues)
+}
+
 // Error logs to the ERROR, WARNING, and INFO logs.
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Error(args ...any) {
@@ -653,19 +929,48 @@ func ErrorContextDepthf(ctx context.Context, depth int, format string, args ...a
 	ctxlogf(ctx, depth+1, logsink.Error, false, noStack, format, args...)
 }
 
+// ErrorS logs msg and the alternating keys and values in keysAndValues to the ERROR, WARNING, and INFO logs.
+// Text output renders the pairs after msg as key="value".
+func ErrorS(msg string, keysAndValues ...any) {
+	ctxlogs(nil, 1, logsink.Error, false, noStack, msg, keysAndValues)
+}
+
+// ErrorDepthS acts as ErrorS but uses depth to determine which call frame to log.
+// ErrorDepthS(0, "msg") is the same as ErrorS("msg").
+func ErrorDepthS(depth int, msg string, keysAndValues ...any) {
+	ctxlogs(nil, depth+1, logsink.Error, false, noStack, msg, keysAndValues)
+}
+
+// ErrorContextS is like [ErrorS], but with an extra [context.Context] parameter. The
+// context is used to pass the Trace Context to log sinks.
+func ErrorContextS(ctx context.Context, msg string, keysAndValues ...any) {
+	ctxlogs(ctx, 1, logsink.Error, false, noStack, msg, keysAndValues)
+}
+
+// ErrorContextDepthS is like [ErrorDepthS], but with an extra [context.Context] parameter. The
+// context is used to pass the Trace Context to log sinks.
+func ErrorContextDepthS(ctx context.Context, depth int, msg string, keysAndValues ...any) {
+	ctxlogs(ctx, depth+1, logsink.Error, false, noStack, msg, keysAndValues)
+}
+
 func ctxfatalf(ctx context.Context, depth int, format string, args ...any) {
 	ctxlogf(ctx, depth+1, logsink.Fatal, false, withStack, format, args...)
 	flushAndAbort()
 }
 
+func ctxfatals(ctx context.Context, depth int, msg string, kv []any) {
+	ctxlogs(ctx, depth+1, logsink.Fatal, false, withStack, msg, kv)
+	flushAndAbort()
+}
+
 func flushAndAbort() {
-	sinks.file.Flush()
+	Flush()
 
 	err := abortProcess() // Should not return.
 
 	// Failed to abort the process using signals.  Dump a stack trace and exit.
 	Errorf("abortProcess returned unexpectedly: %v", err)
-	sinks.file.Flush()
+	Flush()
 	pprof.Lookup("goroutine").WriteTo(os.Stderr, 1)
 	os.Exit(2) // Exit with the same code as the default SIGABRT handler.
 }
@@ -730,9 +1035,35 @@ func FatalContextDepthf(ctx context.Context, depth int, format string, args ...a
 	ctxfatalf(ctx, depth+1, format, args...)
 }
 
+// FatalS logs msg and the alternating keys and values in keysAndValues to the
+// FATAL, ERROR, WARNING, and INFO logs, including a stack trace of all running
+// goroutines, then calls os.Exit(2).
+// Text output renders the pairs after msg as key="value".
+func FatalS(msg string, keysAndValues ...any) {
+	ctxfatals(nil, 1, msg, keysAndValues)
+}
+
+// FatalDepthS acts as FatalS but uses depth to determine which call frame to log.
+// FatalDepthS(0, "msg") is the same as FatalS("msg").
+func FatalDepthS(depth int, msg string, keysAndValues ...any) {
+	ctxfatals(nil, depth+1, msg, keysAndValues)
+}
+
+// FatalContextS is like [FatalS], but with an extra [context.Context] parameter. The
+// context is used to pass the Trace Context to log sinks.
+func FatalContextS(ctx context.Context, msg string, keysAndValues ...any) {
+	ctxfatals(ctx, 1, msg, keysAndValues)
+}
+
+// FatalContextDepthS is like [FatalDepthS], but with an extra [context.Context] parameter. The
+// context is used to pass the Trace Context to log sinks.
+func FatalContextDepthS(ctx context.Context, depth int, msg string, keysAndValues ...any) {
+	ctxfatals(ctx, depth+1, msg, keysAndValues)
+}
+
 func ctxexitf(ctx context.Context, depth int, format string, args ...any) {
 	ctxlogf(ctx, depth+1, logsink.Fatal, false, noStack, format, args...)
-	sinks.file.Flush()
+	Flush()
 	os.Exit(1)
 }
 
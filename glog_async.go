@@ -0,0 +1,356 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Asynchronous delivery of log entries to slow sinks.
+
+package glog
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+// An OverflowPolicy selects what an asynchronous sink does with a log entry
+// when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the logging call wait for room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the new entry.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued entry to make room for the
+	// new one.
+	OverflowDropOldest
+	// OverflowDropBelow discards the new entry if its severity is below
+	// AsyncOptions.DropBelow, and otherwise waits for room in the queue.
+	OverflowDropBelow
+)
+
+// defaultAsyncQueueSize is the queue size used if AsyncOptions.QueueSize is
+// not positive.
+const defaultAsyncQueueSize = 1024
+
+// AsyncOptions are options for NewAsyncSink and NewAsyncTextSink.
+// A zero AsyncOptions consists entirely of default values.
+type AsyncOptions struct {
+	// QueueSize is the maximum number of entries waiting to be written to the
+	// sink.  If QueueSize is not positive, 1024 is used.
+	QueueSize int
+
+	// Overflow selects what happens to entries logged while the queue is full.
+	// FATAL entries are never dropped, whatever the policy.
+	Overflow OverflowPolicy
+
+	// DropBelow is the severity below which entries are dropped when the queue
+	// is full, if Overflow is OverflowDropBelow.
+	DropBelow Severity
+}
+
+// asyncEntry is a log entry waiting in an asyncQueue.
+type asyncEntry struct {
+	meta   logsink.Meta
+	format string
+	args   []any
+	data   []byte
+}
+
+// asyncQueue is the bounded queue and delivery goroutine shared by AsyncSink
+// and AsyncTextSink.
+type asyncQueue struct {
+	opts AsyncOptions
+
+	// deliver writes an entry to the wrapped sink.  It is only called by the
+	// delivery goroutine.
+	deliver func(e *asyncEntry) error
+
+	mu       sync.Mutex
+	notEmpty sync.Cond // Signaled when an entry is queued or the queue is closed.
+	notFull  sync.Cond // Signaled when an entry is dequeued.
+	idle     sync.Cond // Broadcast when the queue becomes empty and idle.
+	ring     []asyncEntry
+	head, n  int
+	busy     bool  // The delivery goroutine is writing an entry.
+	closed   bool  // Close has been called.
+	err      error // The first error returned by the sink and not yet reported.
+
+	dropped atomic.Int64
+}
+
+// asyncQueues holds the open asyncQueues, which Flush drains.
+var asyncQueues struct {
+	mu sync.Mutex
+	m  map[*asyncQueue]bool
+}
+
+func newAsyncQueue(opts *AsyncOptions, deliver func(e *asyncEntry) error) *asyncQueue {
+	q := &asyncQueue{deliver: deliver}
+	if opts != nil {
+		q.opts = *opts
+	}
+	if q.opts.QueueSize <= 0 {
+		q.opts.QueueSize = defaultAsyncQueueSize
+	}
+	q.ring = make([]asyncEntry, q.opts.QueueSize)
+	q.notEmpty.L = &q.mu
+	q.notFull.L = &q.mu
+	q.idle.L = &q.mu
+
+	asyncQueues.mu.Lock()
+	if asyncQueues.m == nil {
+		asyncQueues.m = make(map[*asyncQueue]bool)
+	}
+	asyncQueues.m[q] = true
+	asyncQueues.mu.Unlock()
+
+	go q.run()
+	return q
+}
+
+// push adds e to the queue, applying the overflow policy if it is full.  It
+// returns the first error returned by the sink since the previous call, if any.
+func (q *asyncQueue) push(e asyncEntry) error {
+	q.mu.Lock()
+	err := q.err
+	q.err = nil
+	if q.closed {
+		q.mu.Unlock()
+		if dErr := q.deliver(&e); dErr != nil && err == nil {
+			err = dErr
+		}
+		return err
+	}
+	defer q.mu.Unlock()
+
+	for q.n == len(q.ring) {
+		if e.meta.Severity != logsink.Fatal {
+			switch q.opts.Overflow {
+			case OverflowDropNewest:
+				q.drop(&e)
+				return err
+			case OverflowDropOldest:
+				q.drop(&q.ring[q.head])
+				q.ring[q.head] = asyncEntry{}
+				q.head = (q.head + 1) % len(q.ring)
+				q.n--
+				continue
+			case OverflowDropBelow:
+				if e.meta.Severity < q.opts.DropBelow {
+					q.drop(&e)
+					return err
+				}
+			}
+		}
+		q.notFull.Wait()
+	}
+	q.ring[(q.head+q.n)%len(q.ring)] = e
+	q.n++
+	q.notEmpty.Signal()
+	return err
+}
+
+// drop counts e as dropped.
+func (q *asyncQueue) drop(e *asyncEntry) {
+	q.dropped.Add(1)
+	atomic.AddInt64(&Stats.AsyncDropped.lines, 1)
+	atomic.AddInt64(&Stats.AsyncDropped.bytes, int64(len(e.data)))
+}
+
+// run delivers queued entries until the queue is closed and empty.
+func (q *asyncQueue) run() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		for q.n == 0 && !q.closed {
+			q.notEmpty.Wait()
+		}
+		if q.n == 0 {
+			return
+		}
+		e := q.ring[q.head]
+		q.ring[q.head] = asyncEntry{}
+		q.head = (q.head + 1) % len(q.ring)
+		q.n--
+		q.busy = true
+		q.notFull.Signal()
+
+		q.mu.Unlock()
+		err := q.deliver(&e)
+		q.mu.Lock()
+
+		q.busy = false
+		if err != nil && q.err == nil {
+			q.err = err
+		}
+		if q.n == 0 {
+			q.idle.Broadcast()
+		}
+	}
+}
+
+// drain waits until all queued entries have been delivered.
+func (q *asyncQueue) drain() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.n > 0 || q.busy {
+		q.idle.Wait()
+	}
+}
+
+// close drains the queue and stops the delivery goroutine.
+func (q *asyncQueue) close() {
+	asyncQueues.mu.Lock()
+	delete(asyncQueues.m, q)
+	asyncQueues.mu.Unlock()
+
+	q.mu.Lock()
+	q.closed = true
+	q.notEmpty.Signal()
+	q.mu.Unlock()
+	q.drain()
+}
+
+// drainAsyncSinks waits until every entry queued for an asynchronous sink
+// has been delivered.
+func drainAsyncSinks() {
+	asyncQueues.mu.Lock()
+	qs := make([]*asyncQueue, 0, len(asyncQueues.m))
+	for q := range asyncQueues.m {
+		qs = append(qs, q)
+	}
+	asyncQueues.mu.Unlock()
+
+	for _, q := range qs {
+		q.drain()
+	}
+}
+
+// AsyncSink is a StructuredSink that queues log entries and writes them to
+// another StructuredSink from a separate goroutine, so that a slow sink does
+// not delay logging calls.
+//
+// The arguments of a logging call are formatted by the wrapped sink after the
+// call returns, so they must not be modified once passed to glog.  The wrapped
+// sink receives entries without their Meta.Context, which is only valid during
+// the logging call.
+//
+// Flush, and logging at FATAL severity, wait for all queued entries to be
+// written.  The wrapped sink must not itself log through glog.
+//
+// An error returned by the wrapped sink is returned by the next call to
+// Printf.
+type AsyncSink struct {
+	sink StructuredSink
+	q    *asyncQueue
+}
+
+// NewAsyncSink returns an AsyncSink that writes to s.  Use RegisterSink to
+// start logging to it.  opts may be nil.
+func NewAsyncSink(s StructuredSink, opts *AsyncOptions) *AsyncSink {
+	a := &AsyncSink{sink: s}
+	a.q = newAsyncQueue(opts, func(e *asyncEntry) error {
+		_, err := a.sink.Printf(&e.meta, e.format, e.args...)
+		return err
+	})
+	return a
+}
+
+// Printf implements StructuredSink.Printf.  It returns 0 bytes written: the
+// entry has not been written yet.
+func (a *AsyncSink) Printf(meta *Meta, format string, args ...any) (n int, err error) {
+	e := asyncEntry{meta: *meta, format: format}
+	e.meta.Context = nil // Not to be retained after the logging call.
+	e.args = append([]any(nil), args...)
+	e.meta.KeysAndValues = append([]any(nil), meta.KeysAndValues...)
+	return 0, a.q.push(e)
+}
+
+// WantStack implements StackWanter.WantStack for the wrapped sink.
+func (a *AsyncSink) WantStack(meta *Meta) bool {
+	sw, ok := a.sink.(StackWanter)
+	return ok && sw.WantStack(meta)
+}
+
+// Dropped returns the number of entries dropped because the queue was full.
+func (a *AsyncSink) Dropped() int64 { return a.q.dropped.Load() }
+
+// Flush waits until all queued entries have been written to the wrapped sink.
+func (a *AsyncSink) Flush() { a.q.drain() }
+
+// Close writes all queued entries and stops the goroutine writing to the
+// wrapped sink.  Entries logged after Close are written synchronously.
+func (a *AsyncSink) Close() { a.q.close() }
+
+// AsyncTextSink is a TextSink that queues log entries and writes them to
+// another TextSink from a separate goroutine, so that a slow sink does not
+// delay logging calls.
+//
+// The wrapped sink receives entries without their Meta.Context, which is only
+// valid during the logging call.
+//
+// Flush, and logging at FATAL severity, wait for all queued entries to be
+// written.  The wrapped sink must not itself log through glog.
+//
+// An error returned by the wrapped sink is returned by the next call to Emit.
+type AsyncTextSink struct {
+	sink TextSink
+	q    *asyncQueue
+}
+
+// NewAsyncTextSink returns an AsyncTextSink that writes to s.  Use
+// RegisterTextSink to start logging to it.  opts may be nil.
+func NewAsyncTextSink(s TextSink, opts *AsyncOptions) *AsyncTextSink {
+	a := &AsyncTextSink{sink: s}
+	a.q = newAsyncQueue(opts, func(e *asyncEntry) error {
+		_, err := a.sink.Emit(&e.meta, e.data)
+		return err
+	})
+	return a
+}
+
+// Enabled implements TextSink.Enabled by calling the wrapped sink's Enabled
+// method synchronously.
+func (a *AsyncTextSink) Enabled(meta *Meta) bool { return a.sink.Enabled(meta) }
+
+// Formatter implements CustomFormatter.Formatter for the wrapped sink.
+func (a *AsyncTextSink) Formatter(meta *Meta) Formatter {
+	if cf, ok := a.sink.(CustomFormatter); ok {
+		return cf.Formatter(meta)
+	}
+	return nil
+}
+
+// Emit implements TextSink.Emit.  It returns len(data) bytes written, since
+// the entry has not been written yet.
+func (a *AsyncTextSink) Emit(meta *Meta, data []byte) (n int, err error) {
+	e := asyncEntry{meta: *meta}
+	e.meta.Context = nil // Not to be retained after the logging call.
+	e.meta.KeysAndValues = append([]any(nil), meta.KeysAndValues...)
+	e.data = append([]byte(nil), data...)
+	return len(data), a.q.push(e)
+}
+
+// Dropped returns the number of entries dropped because the queue was full.
+func (a *AsyncTextSink) Dropped() int64 { return a.q.dropped.Load() }
+
+// Flush waits until all queued entries have been written to the wrapped sink.
+func (a *AsyncTextSink) Flush() { a.q.drain() }
+
+// Close writes all queued entries and stops the goroutine writing to the
+// wrapped sink.  Entries logged after Close are written synchronously.
+func (a *AsyncTextSink) Close() { a.q.close() }
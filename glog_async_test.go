@@ -0,0 +1,225 @@
+package glog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// gatedSink is a StructuredSink that records the messages it receives, after
+// waiting for its gate to open.
+type gatedSink struct {
+	gate chan struct{}
+	err  error
+
+	mu   sync.Mutex
+	msgs []string
+}
+
+func newGatedSink() *gatedSink { return &gatedSink{gate: make(chan struct{})} }
+
+func (s *gatedSink) Printf(meta *Meta, format string, args ...any) (int, error) {
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, fmt.Sprintf(format, args...))
+	return 0, s.err
+}
+
+func (s *gatedSink) Msgs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.msgs...)
+}
+
+// fill logs n INFO entries to a, returning once the first has been dequeued
+// and the rest are queued.
+func fill(t *testing.T, a *AsyncSink, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		a.Printf(&Meta{Severity: SeverityInfo}, "%d", i)
+		if i == 0 {
+			// Wait for the delivery goroutine to take the first entry, so that
+			// the queue holds exactly the remaining ones.
+			for {
+				a.q.mu.Lock()
+				busy := a.q.busy
+				a.q.mu.Unlock()
+				if busy {
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestAsyncSinkOverflow(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts AsyncOptions
+		sev  Severity
+		want []string
+	}{
+		{
+			name: "drop newest",
+			opts: AsyncOptions{QueueSize: 2, Overflow: OverflowDropNewest},
+			sev:  SeverityError,
+			want: []string{"0", "1", "2"},
+		},
+		{
+			name: "drop oldest",
+			opts: AsyncOptions{QueueSize: 2, Overflow: OverflowDropOldest},
+			sev:  SeverityInfo,
+			want: []string{"0", "2", "new"},
+		},
+		{
+			name: "drop below, dropped",
+			opts: AsyncOptions{QueueSize: 2, Overflow: OverflowDropBelow, DropBelow: SeverityError},
+			sev:  SeverityWarning,
+			want: []string{"0", "1", "2"},
+		},
+		{
+			name: "fatal is never dropped",
+			opts: AsyncOptions{QueueSize: 2, Overflow: OverflowDropNewest},
+			sev:  SeverityFatal,
+			want: []string{"0", "1", "2", "new"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dropped := atomic.LoadInt64(&Stats.AsyncDropped.lines)
+			s := newGatedSink()
+			a := NewAsyncSink(s, &test.opts)
+			defer a.Close()
+
+			fill(t, a, 3)
+			done := make(chan struct{})
+			go func() {
+				a.Printf(&Meta{Severity: test.sev}, "new")
+				close(done)
+			}()
+			if test.sev == SeverityFatal {
+				// The entry waits for room in the queue.
+				close(s.gate)
+				<-done
+			} else {
+				<-done
+				close(s.gate)
+			}
+			a.Flush()
+
+			got := s.Msgs()
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("sink got %q, want %q", got, test.want)
+			}
+			wantDropped := int64(3 + 1 - len(test.want))
+			if got := a.Dropped(); got != wantDropped {
+				t.Errorf("Dropped() = %d, want %d", got, wantDropped)
+			}
+			if got := atomic.LoadInt64(&Stats.AsyncDropped.lines) - dropped; got != wantDropped {
+				t.Errorf("Stats.AsyncDropped.Lines() increased by %d, want %d", got, wantDropped)
+			}
+		})
+	}
+}
+
+// Test that the blocking policy loses nothing and that Flush drains the queue.
+func TestAsyncSinkBlock(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	s := newGatedSink()
+	close(s.gate)
+	a := NewAsyncSink(s, &AsyncOptions{QueueSize: 1})
+	handle := RegisterSink(a)
+	defer a.Close()
+	defer UnregisterSink(handle)
+
+	const n = 100
+	for i := 0; i < n; i++ {
+		Info(i)
+	}
+	Flush()
+	if got := len(s.Msgs()); got != n {
+		t.Errorf("sink got %d entries after Flush, want %d", got, n)
+	}
+	if got := a.Dropped(); got != 0 {
+		t.Errorf("Dropped() = %d, want 0", got)
+	}
+}
+
+// Test that errors from the wrapped sink are reported by the next call.
+func TestAsyncSinkError(t *testing.T) {
+	s := newGatedSink()
+	close(s.gate)
+	s.err = errors.New("sink failed")
+	a := NewAsyncSink(s, nil)
+	defer a.Close()
+
+	if _, err := a.Printf(&Meta{}, "first"); err != nil {
+		t.Errorf("first Printf returned %v, want nil", err)
+	}
+	a.Flush()
+	if _, err := a.Printf(&Meta{}, "second"); err != s.err {
+		t.Errorf("second Printf returned %v, want %v", err, s.err)
+	}
+}
+
+func TestAsyncTextSink(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	var s savingTextSink
+	a := NewAsyncTextSink(&s, nil)
+	handle := RegisterTextSink(a)
+	defer a.Close()
+	defer UnregisterSink(handle)
+
+	Warning("async text")
+	Flush()
+	if got := s.String(); !strings.Contains(got, "async text") || got[0] != 'W' {
+		t.Errorf("text sink got %q, want WARNING entry", got)
+	}
+}
+
+// contextSink is a StructuredSink and TextSink that records the Context of
+// the entries it receives.
+type contextSink struct {
+	mu   sync.Mutex
+	ctxs []context.Context
+}
+
+func (s *contextSink) Printf(meta *Meta, format string, args ...any) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ctxs = append(s.ctxs, meta.Context)
+	return 0, nil
+}
+
+func (s *contextSink) Enabled(*Meta) bool { return true }
+
+func (s *contextSink) Emit(meta *Meta, data []byte) (int, error) {
+	return s.Printf(meta, "")
+}
+
+// Test that queued entries do not keep the Context of the logging call.
+func TestAsyncSinkContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &contextSink{}
+	a := NewAsyncSink(s, nil)
+	defer a.Close()
+	at := NewAsyncTextSink(s, nil)
+	defer at.Close()
+
+	a.Printf(&Meta{Context: ctx}, "structured")
+	at.Emit(&Meta{Context: ctx}, []byte("text\n"))
+	a.Flush()
+	at.Flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.ctxs) != 2 || s.ctxs[0] != nil || s.ctxs[1] != nil {
+		t.Errorf("wrapped sink got contexts %v, want two nil contexts", s.ctxs)
+	}
+}
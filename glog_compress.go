@@ -0,0 +1,189 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Compression of rotated log files.
+
+package glog
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A Compressor compresses log files once they have been rotated.
+type Compressor interface {
+	// Extension returns the suffix, such as ".gz", appended to the names of
+	// compressed files.
+	Extension() string
+
+	// Compress writes the compressed contents of r to w.
+	Compress(w io.Writer, r io.Reader) error
+}
+
+// GzipCompressor is a Compressor that produces gzip files, as selected by
+// -log_compress=gzip.
+var GzipCompressor Compressor = gzipCompressor{}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Extension() string { return ".gz" }
+
+func (gzipCompressor) Compress(w io.Writer, r io.Reader) error {
+	zw := gzip.NewWriter(w)
+	if _, err := io.Copy(zw, r); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// compressFlag is the flag.Value for the -log_compress flag.  It holds the
+// Compressor for rotated log files, or nil if they are not compressed.
+type compressFlag struct {
+	c atomic.Pointer[Compressor]
+}
+
+func (f *compressFlag) get() Compressor {
+	if c := f.c.Load(); c != nil {
+		return *c
+	}
+	return nil
+}
+
+func (f *compressFlag) set(c Compressor) {
+	if c == nil {
+		f.c.Store(nil)
+		return
+	}
+	f.c.Store(&c)
+}
+
+func (f *compressFlag) String() string {
+	switch c := f.get(); c {
+	case nil:
+		return ""
+	case GzipCompressor:
+		return "gzip"
+	default:
+		return fmt.Sprintf("%T", c)
+	}
+}
+
+func (f *compressFlag) Get() any { return f.get() }
+
+func (f *compressFlag) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "", "none":
+		f.set(nil)
+	case "gzip":
+		f.set(GzipCompressor)
+	default:
+		return fmt.Errorf("unknown log compression %q (want gzip or none; use SetCompressor for others)", value)
+	}
+	return nil
+}
+
+var logCompress compressFlag // The -log_compress flag.
+
+func init() {
+	flag.Var(&logCompress, glogFlag("log_compress"), "If set to gzip, compress log files in the background once they are rotated")
+}
+
+// SetCompressor sets the Compressor for rotated log files, overriding
+// -log_compress.  A nil c disables compression.
+func SetCompressor(c Compressor) {
+	logCompress.set(c)
+}
+
+// maxConcurrentCompressions bounds the number of log files compressed at once.
+const maxConcurrentCompressions = 2
+
+var (
+	compressSem  = make(chan struct{}, maxConcurrentCompressions)
+	compressions sync.WaitGroup // Compressions in progress.
+)
+
+// compressLogFile compresses the closed log file name, which sb has rotated
+// away from, to name+c.Extension() in the background, then removes it and
+// replaces name with the new name in sb.names.
+//
+// The header and footer lines chaining the log files already refer to the
+// compressed name (see rotateFile).  If compression fails, the uncompressed
+// file is kept.
+func compressLogFile(sb *syncBuffer, name string, c Compressor) {
+	compressions.Add(1)
+	go func() {
+		defer compressions.Done()
+		compressSem <- struct{}{}
+		defer func() { <-compressSem }()
+
+		cname := name + c.Extension()
+		if err := compressFile(cname, name, c); err != nil {
+			return
+		}
+		os.Remove(name)
+
+		sinks.file.mu.Lock()
+		defer sinks.file.mu.Unlock()
+		for i, n := range sb.names {
+			if n == name {
+				sb.names[i] = cname
+			}
+		}
+	}()
+}
+
+// compressFile writes the compressed contents of the file src to the new file
+// dst, giving it the permissions and modification time of src.  If it fails
+// after creating dst, it removes dst; it never touches an existing dst.
+func compressFile(dst, src string, c Compressor) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+	if err := setFilePerms(out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := c.Compress(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
@@ -0,0 +1,107 @@
+package glog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+func TestCompressRotatedFile(t *testing.T) {
+	setFlags()
+	useLogDir(t, t.TempDir())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	fakeNow := time.Date(2024, 6, 7, 8, 9, 10, 0, time.Local)
+	timeNow = func() time.Time { return fakeNow }
+
+	SetCompressor(GzipCompressor)
+	defer SetCompressor(nil)
+
+	Error("x") // Be sure we have a file.
+	sinks.file.mu.Lock()
+	errLog, ok := sinks.file.file[logsink.Error].(*syncBuffer)
+	sinks.file.mu.Unlock()
+	if !ok {
+		t.Fatal("error log wasn't created")
+	}
+	// rotate starts a new file at time now, and returns the name of the
+	// previous one and of the new one.
+	rotate := func(now time.Time) (string, string) {
+		t.Helper()
+		sinks.file.mu.Lock()
+		defer sinks.file.mu.Unlock()
+		previous := errLog.file.Name()
+		if err := errLog.rotateFile(now); err != nil {
+			t.Fatalf("rotateFile: %v", err)
+		}
+		return previous, errLog.file.Name()
+	}
+	rotate(fakeNow.Add(-time.Second))
+	Error("compressed")
+	fname0, fname1 := rotate(fakeNow)
+	compressions.Wait()
+
+	if _, err := os.Stat(fname0); !os.IsNotExist(err) {
+		t.Errorf("os.Stat(%s) = %v, want the uncompressed file removed", fname0, err)
+	}
+	f, err := os.Open(fname0 + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "] compressed\n") || !strings.Contains(string(b), "Next log: "+fname1+".gz\n") {
+		t.Errorf("%s.gz has contents:\n%s\nwant the entry and a footer naming %s.gz", fname0, b, fname1)
+	}
+
+	names, err := Names("ERROR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(names, "\n"), fname0+".gz") {
+		t.Errorf("Names(ERROR) = %v, want it to contain %s.gz", names, fname0)
+	}
+
+	sinks.file.Flush()
+	b, err = os.ReadFile(fname1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "Previous log: "+fname0+".gz\n") {
+		t.Errorf("%s has header:\n%s\nwant it to name %s.gz", fname1, b, fname0)
+	}
+}
+
+// Test that a failed compression leaves both the log file and an existing
+// file with the compressed name alone.
+func TestCompressExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "x.log")
+	if err := os.WriteFile(name, []byte("log"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cname := name + GzipCompressor.Extension()
+	if err := os.WriteFile(cname, []byte("other"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	compressLogFile(&syncBuffer{}, name, GzipCompressor)
+	compressions.Wait()
+	for path, want := range map[string]string{name: "log", cname: "other"} {
+		if b, err := os.ReadFile(path); err != nil || string(b) != want {
+			t.Errorf("os.ReadFile(%s) = %q, %v, want %q", path, b, err, want)
+		}
+	}
+}
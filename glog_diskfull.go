@@ -0,0 +1,316 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Handling of full disks by the file sink.
+
+package glog
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+// diskFullProbeInterval is the interval at which the file sink tries to write
+// entries below -log_disk_full_keep again once the disk is full.
+const diskFullProbeInterval = 10 * time.Second
+
+var (
+	logDiskFullKeep severityFlag // The -log_disk_full_keep flag.
+	logDiskReserve  = flag.Uint64(glogFlag("log_disk_reserve"), 0, "If positive, reserve this many bytes in each log directory for ERROR and FATAL entries, released when the disk becomes full")
+)
+
+func init() {
+	logDiskFullKeep = severityFlag(logsink.Error)
+	flag.Var(&logDiskFullKeep, glogFlag("log_disk_full_keep"), "while the log disk is full, keep writing entries at or above this severity to log files, dropping the others")
+}
+
+// diskFullState tracks the state of the file sink while the disk is full.
+// fileSink.mu is held to access it.
+type diskFullState struct {
+	active    bool
+	since     time.Time // When the disk was found to be full.
+	nextProbe time.Time // When to next try writing a dropped entry.
+	entries   int64     // Entries dropped since the disk was found to be full.
+	bytes     int64     // Bytes dropped since the disk was found to be full.
+
+	reserves map[string]uint64 // The reservation in each directory, by number.
+}
+
+// drop counts a dropped entry of n bytes.
+func (d *diskFullState) drop(entries int, n int) {
+	d.entries += int64(entries)
+	d.bytes += int64(n)
+	atomic.AddInt64(&Stats.DiskFullDropped.lines, int64(entries))
+	atomic.AddInt64(&Stats.DiskFullDropped.bytes, int64(n))
+}
+
+// syncBuffers returns the log files of s.
+// s.mu is held.
+func (s *fileSink) syncBuffers() []*syncBuffer {
+	buffers := make([]*syncBuffer, 0, len(s.file)+1)
+	for _, w := range s.file {
+		if sb, ok := w.(*syncBuffer); ok {
+			buffers = append(buffers, sb)
+		}
+	}
+	if s.single != nil {
+		buffers = append(buffers, s.single)
+	}
+	return buffers
+}
+
+// writeFiles writes data, the entry described by m, to files.
+//
+// If the disk is full, entries below -log_disk_full_keep are dropped, except
+// that one is written every diskFullProbeInterval to find out whether space
+// has been freed; entries at or above it are still written, using the space
+// reserved by -log_disk_reserve.  Dropped entries are not errors.
+// s.mu is held.
+func (s *fileSink) writeFiles(m *logsink.Meta, files []flushSyncWriter, data []byte) error {
+	d := &s.diskFull
+	keep := m.Severity >= logDiskFullKeep.get()
+	if d.active && !keep {
+		now := timeNow()
+		if now.Before(d.nextProbe) {
+			d.drop(1, len(data))
+			return nil
+		}
+		d.nextProbe = now.Add(diskFullProbeInterval)
+		if err := s.endDiskFull(now); err != nil {
+			if !isDiskFull(err) {
+				return err
+			}
+			s.discardBuffered()
+			d.drop(1, len(data))
+			return nil
+		}
+	}
+
+	err := writeAll(files, data, d.active)
+	if err == nil || !isDiskFull(err) {
+		return err
+	}
+	s.discardBuffered()
+	if !d.active {
+		s.startDiskFull(timeNow())
+		if keep {
+			// Retry in the space just released.
+			if err = writeAll(files, data, true); err == nil || !isDiskFull(err) {
+				return err
+			}
+			s.discardBuffered()
+		}
+	}
+	d.drop(1, len(data))
+	return nil
+}
+
+// writeAll writes data to each of files, and flushes them if flush is true.
+// It returns the first error.
+func writeAll(files []flushSyncWriter, data []byte, flush bool) error {
+	var err error
+	for _, f := range files {
+		_, fErr := f.Write(data)
+		if fErr == nil && flush {
+			fErr = f.Flush()
+		}
+		if fErr != nil && err == nil {
+			err = fErr // Take the first error.
+		}
+	}
+	return err
+}
+
+// discardBuffered discards the data buffered for the log files, which cannot
+// be written because the disk is full, counting it as dropped.  A bufio.Writer
+// keeps failing once a write has failed, so this also makes the files writable
+// again.
+// s.mu is held.
+func (s *fileSink) discardBuffered() {
+	for _, sb := range s.syncBuffers() {
+		if sb.file == nil {
+			continue
+		}
+		lost := sb.Buffered()
+		sb.Writer.Reset(sb.file)
+		sb.nbytes -= uint64(lost)
+		s.diskFull.drop(0, lost)
+	}
+}
+
+// startDiskFull records that the disk has been found to be full at time now,
+// and releases the reserved space.
+// s.mu is held.
+func (s *fileSink) startDiskFull(now time.Time) {
+	d := &s.diskFull
+	d.active = true
+	d.since = now
+	d.nextProbe = now.Add(diskFullProbeInterval)
+	d.entries, d.bytes = 0, 0
+	d.releaseReserves()
+}
+
+// releaseReserves deletes the files created by reserveSpace, or about to be.
+func (d *diskFullState) releaseReserves() {
+	for dir := range d.reserves {
+		os.Remove(reserveName(dir))
+		delete(d.reserves, dir)
+	}
+}
+
+// endDiskFull writes a marker recording the entries dropped since the disk
+// was found to be full to each log file.  If that succeeds, the disk is no
+// longer considered full, and space is reserved again.
+// s.mu is held.
+func (s *fileSink) endDiskFull(now time.Time) error {
+	d := &s.diskFull
+	marker := diskFullMarker(d.since, now, d.entries, d.bytes)
+	var files []flushSyncWriter
+	for _, w := range s.file {
+		if w != nil {
+			files = append(files, w)
+		}
+	}
+	if s.single != nil {
+		files = append(files, s.single)
+	}
+	for _, w := range files {
+		_, err := w.Write(marker)
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	d.active = false
+	for _, sb := range s.syncBuffers() {
+		if sb.file != nil {
+			s.reserveSpace(filepath.Dir(sb.file.Name()))
+		}
+	}
+	return nil
+}
+
+// diskFullMarker returns the line recording that entries entries of n bytes
+// in total were dropped between since and now because the disk was full.
+func diskFullMarker(since, now time.Time, entries, n int64) []byte {
+	if jsonFiles() {
+		b, _ := json.Marshal(struct {
+			Since   string `json:"disk_full_since"`
+			Until   string `json:"disk_full_until"`
+			Entries int64  `json:"dropped_entries"`
+			Bytes   int64  `json:"dropped_bytes"`
+		}{since.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano), entries, n})
+		return append(b, '\n')
+	}
+	return []byte(fmt.Sprintf("Disk full from %s to %s: dropped %d log entries (%d bytes)\n",
+		since.Format("2006/01/02 15:04:05"), now.Format("2006/01/02 15:04:05"), entries, n))
+}
+
+var (
+	reservations sync.WaitGroup // Reserve files being written.
+	// reserveMu is held while a reserve file is written and until the writer
+	// has checked that it is still wanted, so that a file left by a released
+	// reservation is never mistaken for that of a newer one.
+	reserveMu  sync.Mutex
+	reserveSeq uint64 // The number of the last reservation; fileSink.mu is held to access it.
+)
+
+// reserveName returns the name of the reserve file in dir.  It is the same for
+// every run of the program, so that a reserve left behind by a run that did
+// not call Shutdown is reused rather than accumulating.
+func reserveName(dir string) string {
+	return filepath.Join(dir, "."+program+".log_reserve")
+}
+
+// reserveSpace creates a file of -log_disk_reserve bytes in dir, unless there
+// is one already or the disk is full.  Its space is released for ERROR and
+// FATAL entries when the disk becomes full.
+//
+// The file is written in the background, without holding s.mu, and is
+// removed if its reservation has been released in the meantime.
+// s.mu is held.
+func (s *fileSink) reserveSpace(dir string) {
+	d := &s.diskFull
+	size := *logDiskReserve
+	if size == 0 || d.active || d.reserves[dir] != 0 {
+		return
+	}
+	reserveSeq++
+	seq := reserveSeq
+	if d.reserves == nil {
+		d.reserves = make(map[string]uint64)
+	}
+	d.reserves[dir] = seq
+
+	reservations.Add(1)
+	go func() {
+		defer reservations.Done()
+		reserveMu.Lock()
+		defer reserveMu.Unlock()
+		name := reserveName(dir)
+		err := writeReserve(name, size)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.diskFull.reserves[dir] != seq {
+			os.Remove(name) // Released while being written.
+		} else if err != nil {
+			delete(s.diskFull.reserves, dir)
+		}
+	}()
+}
+
+// writeReserve fills the file name with size zero bytes, unless it is already
+// a file of at least that size, as left by an earlier run.  If that fails, the
+// file is removed.
+func writeReserve(name string, size uint64) error {
+	if fi, err := os.Lstat(name); err == nil && fi.Mode().IsRegular() && uint64(fi.Size()) >= size {
+		return nil
+	}
+	os.Remove(name) // ignore err
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, newFileMode())
+	if err != nil {
+		return err
+	}
+	// Write zeros rather than truncating, so that the blocks are allocated.
+	zeros := make([]byte, 64*1024)
+	for left := size; left > 0 && err == nil; {
+		chunk := zeros
+		if left < uint64(len(chunk)) {
+			chunk = chunk[:left]
+		}
+		var n int
+		n, err = f.Write(chunk)
+		left -= uint64(n)
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+//go:build unix
+
+package glog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fullBuffer is a flushSyncWriter that fails with ENOSPC while full is set.
+type fullBuffer struct {
+	bytes.Buffer
+	full bool
+}
+
+func (f *fullBuffer) Write(p []byte) (int, error) {
+	if f.full {
+		return 0, syscall.ENOSPC
+	}
+	return f.Buffer.Write(p)
+}
+
+func (f *fullBuffer) Flush() error        { return nil }
+func (f *fullBuffer) Sync() error         { return nil }
+func (f *fullBuffer) filenames() []string { return nil }
+
+func TestDiskFull(t *testing.T) {
+	setFlags()
+	info, errs := &fullBuffer{full: true}, &fullBuffer{}
+	defer sinks.file.swap(sinks.file.swap(severityWriters{info, info, errs, errs}))
+	defer func() {
+		sinks.file.mu.Lock()
+		defer sinks.file.mu.Unlock()
+		sinks.file.diskFull = diskFullState{}
+	}()
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	fakeNow := time.Now()
+	timeNow = func() time.Time { return fakeNow }
+	oneOutput = true
+	defer func() { oneOutput = false }()
+	droppedBefore := Stats.DiskFullDropped.Lines()
+
+	Info("dropped")
+	Warning("dropped too")
+	Error("kept")
+	if !strings.Contains(errs.String(), "] kept\n") {
+		t.Errorf("ERROR file has %q, want the ERROR entry written while the disk is full", errs.String())
+	}
+	if got := Stats.DiskFullDropped.Lines() - droppedBefore; got != 2 {
+		t.Errorf("Stats.DiskFullDropped.Lines() increased by %d, want 2", got)
+	}
+
+	// Nothing is written before the next probe, even once space is available.
+	info.full = false
+	Info("dropped before probe")
+	if info.Len() != 0 {
+		t.Errorf("INFO file has %q before the next probe, want nothing", info.String())
+	}
+
+	fakeNow = fakeNow.Add(diskFullProbeInterval)
+	Info("resumed")
+	want := "dropped 3 log entries"
+	if got := info.String(); !strings.Contains(got, want) || !strings.HasSuffix(got, "] resumed\n") {
+		t.Errorf("INFO file has %q, want a marker with %q followed by the new entry", got, want)
+	}
+	if !strings.Contains(errs.String(), want) {
+		t.Errorf("ERROR file has %q, want a marker with %q", errs.String(), want)
+	}
+	sinks.file.mu.Lock()
+	active := sinks.file.diskFull.active
+	sinks.file.mu.Unlock()
+	if active {
+		t.Error("disk still considered full after a successful probe")
+	}
+}
+
+func TestDiskReserve(t *testing.T) {
+	setFlags()
+	dir := t.TempDir()
+	useLogDir(t, dir)
+	defer func(previous uint64) { *logDiskReserve = previous }(*logDiskReserve)
+	*logDiskReserve = 100000
+
+	Info("x")
+	reservations.Wait()
+	reserves, err := filepath.Glob(filepath.Join(dir, ".*.log_reserve"))
+	if err != nil || len(reserves) != 1 {
+		t.Fatalf("reserve files = %v, %v, want one", reserves, err)
+	}
+	if fi, err := os.Stat(reserves[0]); err != nil || fi.Size() != 100000 {
+		t.Fatalf("os.Stat(%s) = %v, %v, want 100000 bytes", reserves[0], fi, err)
+	}
+
+	// A later run reuses the reserve left behind by one that did not call
+	// Shutdown.
+	sinks.file.mu.Lock()
+	sinks.file.diskFull.reserves = nil
+	sinks.file.reserveSpace(dir)
+	sinks.file.mu.Unlock()
+	reservations.Wait()
+	if again, err := filepath.Glob(filepath.Join(dir, ".*.log_reserve")); err != nil || len(again) != 1 || again[0] != reserves[0] {
+		t.Fatalf("reserve files after another reservation = %v, %v, want %s only", again, err, reserves[0])
+	}
+
+	sinks.file.mu.Lock()
+	sinks.file.startDiskFull(time.Now())
+	sinks.file.mu.Unlock()
+	if _, err := os.Stat(reserves[0]); !os.IsNotExist(err) {
+		t.Errorf("os.Stat(%s) = %v once the disk is full, want the reserve released", reserves[0], err)
+	}
+}
@@ -20,16 +20,18 @@ package glog
 
 import (
 	"bufio"
-	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"runtime"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog/internal/logsink"
@@ -41,15 +43,19 @@ var logDirs []string
 var (
 	// If non-empty, overrides the choice of directory in which to write logs.
 	// See createLogDirs for the full list of possible destinations.
-	logDir      = flag.String("log_dir", "", "If non-empty, write log files in this directory")
-	logLink     = flag.String("log_link", "", "If non-empty, add symbolic links in this directory to the log files")
-	logBufLevel = flag.Int("logbuflevel", int(logsink.Info), "Buffer log messages logged at this level or lower"+
+	logDir       = flag.String(glogFlag("log_dir"), "", "If non-empty, write log files in the first writable directory of this list (separated by the OS path list separator)")
+	logDirCreate = flag.Bool(glogFlag("log_dir_create"), false, "If true, create missing -log_dir directories, with the mode set by -log_file_mode")
+	logLink      = flag.String(glogFlag("log_link"), "", "If non-empty, add symbolic links in this directory to the log files")
+	logFile      = flag.String(glogFlag("log_file"), "", "If non-empty, write log entries of all severities to this file instead of to per-severity files in the log directory")
+	logBufLevel  = flag.Int(glogFlag("logbuflevel"), int(logsink.Info), "Buffer log messages logged at this level or lower"+
 		" (-1 means don't buffer; 0 means buffer INFO only; ...). Has limited applicability on non-prod platforms.")
 )
 
 func createLogDirs() {
-	if *logDir != "" {
-		logDirs = append(logDirs, *logDir)
+	for _, dir := range filepath.SplitList(*logDir) {
+		if dir != "" {
+			logDirs = append(logDirs, dir)
+		}
 	}
 	logDirs = append(logDirs, os.TempDir())
 }
@@ -92,24 +98,27 @@ func shortHostname(hostname string) string {
 	return hostname
 }
 
-// logName returns a new log file name containing tag, with start time t, and
-// the name for the symlink for tag.
-func logName(tag string, t time.Time) (name, link string) {
-	name = fmt.Sprintf("%s.%s.%s.log.%s.%04d%02d%02d-%02d%02d%02d.%d",
-		program,
-		host,
-		userName,
-		tag,
-		t.Year(),
-		t.Month(),
-		t.Day(),
-		t.Hour(),
-		t.Minute(),
-		t.Second(),
-		pid)
-	return name, program + "." + tag
+// logName returns a new log file name containing tag, with start time t and
+// sequence number seq, and the name for the symlink for tag.  The file name is
+// relative to the log directory, and may contain subdirectories.
+func logName(tag string, t time.Time, seq int) (name, link string) {
+	return fileTemplate.get().expand(tag, t, seq), linkTemplate.get().expand(tag, t, seq)
 }
 
+// logRoot returns the log directory containing the log file name, created
+// with the current -log_file_template.
+func logRoot(name string) string {
+	dir := filepath.Dir(name)
+	for i := 0; i < fileTemplate.get().depth; i++ {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// maxSeqAttempts bounds the number of sequence numbers tried by createInDir
+// when log files with the previous ones exist.
+const maxSeqAttempts = 1000
+
 var onceLogDirs sync.Once
 
 // create creates a new log file and returns the file and its filename, which
@@ -122,7 +131,7 @@ func create(tag string, t time.Time, dir string) (f *os.File, filename string, e
 		if err == nil {
 			return f, name, err
 		}
-		return nil, "", fmt.Errorf("log: cannot create log: %v", err)
+		return nil, "", fmt.Errorf("log: cannot create log: %w", err)
 	}
 
 	onceLogDirs.Do(createLogDirs)
@@ -137,30 +146,48 @@ func create(tag string, t time.Time, dir string) (f *os.File, filename string, e
 		}
 		lastErr = err
 	}
-	return nil, "", fmt.Errorf("log: cannot create log: %v", lastErr)
+	return nil, "", fmt.Errorf("log: cannot create log: %w", lastErr)
 }
 
 func createInDir(dir, tag string, t time.Time) (f *os.File, name string, err error) {
-	name, link := logName(tag, t)
-	fname := filepath.Join(dir, name)
-	// O_EXCL is important here, as it prevents a vulnerability. The general idea is that logs often
-	// live in an insecure directory (like /tmp), so an unprivileged attacker could create fname in
-	// advance as a symlink to a file the logging process can access, but the attacker cannot. O_EXCL
-	// fails the open if it already exists, thus prevent our this code from opening the existing file
-	// the attacker points us to.
-	f, err = os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
-	if err == nil {
-		symlink := filepath.Join(dir, link)
-		os.Remove(symlink)        // ignore err
-		os.Symlink(name, symlink) // ignore err
-		if *logLink != "" {
-			lsymlink := filepath.Join(*logLink, link)
-			os.Remove(lsymlink)         // ignore err
-			os.Symlink(fname, lsymlink) // ignore err
+	if *logDirCreate {
+		if err := mkdirAll(dir); err != nil {
+			return nil, "", err
+		}
+	}
+	tmpl := fileTemplate.get()
+	for attempt := 0; ; attempt++ {
+		var link string
+		name, link = logName(tag, t, nextSeq(tag))
+		fname := filepath.Join(dir, name)
+		if tmpl.depth > 0 {
+			if err := mkdirAll(filepath.Dir(fname)); err != nil {
+				return nil, "", err
+			}
+		}
+		// O_EXCL is important here, as it prevents a vulnerability. The general idea is that logs often
+		// live in an insecure directory (like /tmp), so an unprivileged attacker could create fname in
+		// advance as a symlink to a file the logging process can access, but the attacker cannot. O_EXCL
+		// fails the open if it already exists, thus prevent our this code from opening the existing file
+		// the attacker points us to.
+		// O_APPEND keeps entries from being written past the end of the file,
+		// leaving a hole, once another program truncates it.
+		f, err = os.OpenFile(fname, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_EXCL, newFileMode())
+		if err == nil {
+			if err := setFilePerms(f); err != nil {
+				f.Close()
+				os.Remove(fname)
+				return nil, "", err
+			}
+			updateLinks(dir, link, fname)
+			return f, fname, nil
+		}
+		// A template with {seq} can avoid an existing file by moving on to the
+		// next sequence number.
+		if !tmpl.hasSeq || !os.IsExist(err) || attempt+1 >= maxSeqAttempts {
+			return nil, "", err
 		}
-		return f, fname, nil
 	}
-	return nil, "", err
 }
 
 // flushSyncWriter is the interface satisfied by logging destinations.
@@ -174,6 +201,7 @@ type flushSyncWriter interface {
 var sinks struct {
 	stderr stderrSink
 	file   fileSink
+	flight flightRecorderSink
 }
 
 func init() {
@@ -185,7 +213,7 @@ func init() {
 	logsink.TextSinks = append(logsink.TextSinks, &sinks.file)
 
 	sinks.file.flushChan = make(chan logsink.Severity, 1)
-	go sinks.file.flushDaemon()
+	sinks.file.startFlushDaemon()
 }
 
 // stderrSink is a logsink.Text that writes log entries to stderr
@@ -193,14 +221,25 @@ func init() {
 type stderrSink struct {
 	mu sync.Mutex
 	w  io.Writer // if nil Emit uses os.Stderr directly
+
+	formatter sinkFormatter
 }
 
 // Enabled implements logsink.Text.Enabled.  It returns true if any of the
 // various stderr flags are enabled for logs of the given severity, if the log
-// message is from the standard "log" package, or if google.Init has not yet run
-// (and hence file logging is not yet initialized).
+// message is from the standard "log" package, if google.Init has not yet run
+// (and hence file logging is not yet initialized), or if
+// -log_sink_error_policy=stderr has redirected a failed sink to stderr.
 func (s *stderrSink) Enabled(m *logsink.Meta) bool {
-	return toStderr || alsoToStderr || m.Severity >= stderrThreshold.get()
+	if !builtinSinksEnabled() {
+		return false
+	}
+	return toStderr || alsoToStderr || stderrFallback.Load() || m.Severity >= stderrThreshold.get()
+}
+
+// Formatter implements logsink.CustomFormatter.Formatter.
+func (s *stderrSink) Formatter(m *logsink.Meta) logsink.Formatter {
+	return s.formatter.get()
 }
 
 // Emit implements logsink.Text.Emit.
@@ -224,38 +263,156 @@ type severityWriters [4]flushSyncWriter
 type fileSink struct {
 	mu sync.Mutex
 	// file holds writer for each of the log types.
-	file      severityWriters
+	file severityWriters
+	// single is the writer for -log_file, used instead of file when set.
+	single    *syncBuffer
 	flushChan chan logsink.Severity
+
+	formatter sinkFormatter
+
+	diskFull diskFullState
+
+	// stopFlush and flushStopped control the flushDaemon goroutine, if any.
+	stopFlush    chan struct{}
+	flushStopped chan struct{}
+	shutdown     atomic.Bool // Set by Shutdown, until RestartFileSink.
 }
 
 // Enabled implements logsink.Text.Enabled.  It returns true if google.Init
-// has run and both --disable_log_to_disk and --logtostderr are false.
+// has run, both --disable_log_to_disk and --logtostderr are false, and
+// Shutdown has not been called since the sink was last started.
 func (s *fileSink) Enabled(m *logsink.Meta) bool {
-	return !toStderr
+	return !toStderr && builtinSinksEnabled() && !s.shutdown.Load()
+}
+
+// Formatter implements logsink.CustomFormatter.Formatter.
+func (s *fileSink) Formatter(m *logsink.Meta) logsink.Formatter {
+	return s.formatter.get()
+}
+
+// jsonFiles reports whether log entries are written to files as JSON, in which
+// case file headers and footers are JSON too.
+func jsonFiles() bool {
+	f := sinks.file.formatter.get()
+	if f == nil {
+		f = logsink.GetFormatter()
+	}
+	return f == logsink.JSONFormatter
 }
 
 // Emit implements logsink.Text.Emit
 func (s *fileSink) Emit(m *logsink.Meta, data []byte) (n int, err error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	// Remember the files to sync, so we can call sync without holding the
+	// lock, as flush does.
+	var toSync []syncer
+	func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var noAllocFiles severityWriters
+		files := noAllocFiles[:0]
+		if *logFile != "" {
+			if err = s.createSingleFile(); err != nil {
+				return
+			}
+			files = append(files, s.single)
+		} else {
+			sevs := fileSeverities(m.Severity)
+			if err = s.createMissingFiles(sevs); err != nil {
+				return
+			}
+			for sev := m.Severity; sev >= logsink.Info; sev-- {
+				if sevs&(1<<sev) != 0 {
+					files = append(files, s.file[sev])
+				}
+			}
+		}
+		err = s.writeFiles(m, files, data)
+		if sev, ok := logSyncSeverity.get(); ok && m.Severity >= sev && err == nil && !s.diskFull.active {
+			if err = flushFiles(files); err == nil {
+				toSync = syncers(files)
+			}
+		}
+		n = len(data)
+		if int(m.Severity) > *logBufLevel {
+			select {
+			case s.flushChan <- m.Severity:
+			default:
+			}
+		}
+	}()
 
-	if err = s.createMissingFiles(m.Severity); err != nil {
-		return 0, err
+	if toSync != nil {
+		err = syncFiles(toSync)
 	}
-	for sev := m.Severity; sev >= logsink.Info; sev-- {
-		if _, fErr := s.file[sev].Write(data); fErr != nil && err == nil {
+	return n, err
+}
+
+// flushFiles flushes files, as requested by -log_sync_severity.  It returns
+// the first error.
+// s.mu is held.
+func flushFiles(files []flushSyncWriter) error {
+	var err error
+	for _, f := range files {
+		if fErr := f.Flush(); fErr != nil && err == nil {
 			err = fErr // Take the first error.
 		}
 	}
-	n = len(data)
-	if int(m.Severity) > *logBufLevel {
-		select {
-		case s.flushChan <- m.Severity:
-		default:
+	return err
+}
+
+// A syncer is what syncs a log file to disk.
+type syncer interface {
+	Sync() error
+}
+
+// syncers returns what syncs files to disk, to be called once s.mu is
+// released: for a syncBuffer, its current *os.File, which rotation, Reopen or
+// Shutdown may then close and replace but not change.
+// s.mu is held.
+func syncers(files []flushSyncWriter) []syncer {
+	var syncs []syncer
+	for _, f := range files {
+		if sb, ok := f.(*syncBuffer); ok {
+			if sb.file != nil {
+				syncs = append(syncs, sb.file)
+			}
+			continue
 		}
+		syncs = append(syncs, f)
 	}
+	return syncs
+}
 
-	return n, err
+// syncFiles syncs files, as returned by syncers, to disk.  A file closed in the
+// meantime has been rotated away, or closed by Reopen or Shutdown, and is not
+// an error.  syncFiles returns the first error.
+func syncFiles(files []syncer) error {
+	var err error
+	for _, f := range files {
+		if fErr := f.Sync(); fErr != nil && !errors.Is(fErr, os.ErrClosed) && err == nil {
+			err = fErr // Take the first error.
+		}
+	}
+	return err
+}
+
+// createSingleFile creates the -log_file file if it has not already been
+// created.
+// s.mu is held.
+func (s *fileSink) createSingleFile() error {
+	if s.single != nil {
+		return nil
+	}
+	sb := &syncBuffer{
+		sink: s,
+		path: *logFile,
+	}
+	if err := sb.rotateFile(time.Now()); err != nil {
+		return err
+	}
+	s.single = sb
+	return nil
 }
 
 // syncBuffer joins a bufio.Writer to its underlying file, providing access to the
@@ -268,8 +425,13 @@ type syncBuffer struct {
 	file   *os.File
 	names  []string
 	sev    logsink.Severity
+	path   string // The -log_file path, or empty for a per-severity file.
 	nbytes uint64 // The number of bytes written to this file
 	madeAt time.Time
+
+	// rotateAt is the time at which -log_rotate_interval starts a new file, or
+	// zero if it is yet to be computed.
+	rotateAt time.Time
 }
 
 func (sb *syncBuffer) Sync() error {
@@ -287,23 +449,38 @@ func (sb *syncBuffer) Write(p []byte) (n int, err error) {
 			}
 		}
 	}
+	if interval := rotateInterval.get(); interval > 0 {
+		if sb.rotateAt.IsZero() {
+			sb.rotateAt = nextRotation(sb.madeAt, interval, rotateLocation.get())
+		}
+		if now := timeNow(); !now.Before(sb.rotateAt) {
+			if err := sb.rotateFile(now); err != nil {
+				return 0, err
+			}
+		}
+	}
 	n, err = sb.Writer.Write(p)
 	sb.nbytes += uint64(n)
 	return n, err
 }
 
 func (sb *syncBuffer) filenames() []string {
-	return sb.names
+	// Copy the names: compressLogFile may update them.
+	return append([]string(nil), sb.names...)
 }
 
 const footer = "\nCONTINUED IN NEXT FILE\n"
 
 // rotateFile closes the syncBuffer's file and starts a new one.
 func (sb *syncBuffer) rotateFile(now time.Time) error {
+	if sb.path != "" {
+		return sb.rotateSingleFile(now)
+	}
 	var err error
 	pn := "<none>"
 	file, name, err := create(sb.sev.String(), now, "")
 	sb.madeAt = now
+	sb.rotateAt = time.Time{}
 
 	if sb.file != nil {
 		// The current log file becomes the previous log at the end of
@@ -312,12 +489,21 @@ func (sb *syncBuffer) rotateFile(now time.Time) error {
 		pn = sb.file.Name()
 		sb.Flush()
 		// If there's an existing file, write a footer with the name of
-		// the next file in the chain, followed by the constant string
-		// \nCONTINUED IN NEXT FILE\n to make continuation detection simple.
-		sb.file.Write([]byte("Next log: "))
-		sb.file.Write([]byte(name))
-		sb.file.Write([]byte(footer))
+		// the next file in the chain.  If rotated files are compressed, the
+		// chain refers to the names they will have once compressed.
+		next := name
+		c := logCompress.get()
+		if c != nil {
+			if next != "" {
+				next += c.Extension()
+			}
+			pn += c.Extension()
+		}
+		sb.file.Write(fileFooter(next))
 		sb.file.Close()
+		if c != nil {
+			compressLogFile(sb, sb.file.Name(), c)
+		}
 	}
 
 	sb.file = file
@@ -329,35 +515,154 @@ func (sb *syncBuffer) rotateFile(now time.Time) error {
 
 	sb.Writer = bufio.NewWriterSize(sb.file, bufferSize)
 
-	// Write header.
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "Log file created at: %s\n", now.Format("2006/01/02 15:04:05"))
-	fmt.Fprintf(&buf, "Running on machine: %s\n", host)
-	fmt.Fprintf(&buf, "Binary: Built with %s %s for %s/%s\n", runtime.Compiler, runtime.Version(), runtime.GOOS, runtime.GOARCH)
-	fmt.Fprintf(&buf, "Previous log: %s\n", pn)
-	fmt.Fprintf(&buf, "Log line format: [IWEF]mmdd hh:mm:ss.uuuuuu threadid file:line] msg\n")
-	n, err := sb.file.Write(buf.Bytes())
+	n, err := sb.file.Write(fileHeader(now, pn))
 	sb.nbytes += uint64(n)
+	scheduleCleanup(logRoot(name))
+	if sb.sink != nil {
+		sb.sink.reserveSpace(logRoot(name))
+	}
 	return err
 }
 
+// rotateSingleFile opens the -log_file file sb.path for appending.  If it is
+// already open, rotateSingleFile first renames it to the next numbered sibling
+// (such as app.log.3, after app.log.2), so that it starts anew.  If the rename
+// fails, the file is left as it is, to be rotated again once another MaxSize
+// bytes have been written to it.
+func (sb *syncBuffer) rotateSingleFile(now time.Time) error {
+	pn := "<none>"
+	if sb.file != nil {
+		sb.Flush()
+		rotated := nextNumberedName(sb.path)
+		sb.file.Close()
+		if err := renameFile(sb.path, rotated); err != nil {
+			file, openErr := os.OpenFile(sb.path, os.O_WRONLY|os.O_APPEND, 0)
+			sb.file = file
+			sb.nbytes = 0
+			if openErr != nil {
+				sb.names = sb.names[:len(sb.names)-1]
+				return openErr
+			}
+			sb.Writer = bufio.NewWriterSize(sb.file, bufferSize)
+			return err
+		}
+		pn = rotated
+		c := logCompress.get()
+		if c != nil {
+			pn += c.Extension()
+		}
+		if f, err := os.OpenFile(rotated, os.O_WRONLY|os.O_APPEND, 0); err == nil {
+			f.Write(fileFooter(sb.path))
+			f.Close()
+		}
+		sb.names[len(sb.names)-1] = rotated
+		if c != nil {
+			compressLogFile(sb, rotated, c)
+		}
+	}
+
+	file, err := os.OpenFile(sb.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, newFileMode())
+	sb.madeAt = now
+	sb.rotateAt = time.Time{}
+	sb.file = file
+	sb.nbytes = 0
+	if err != nil {
+		return err
+	}
+	sb.names = append(sb.names, sb.path)
+	if fi, err := file.Stat(); err == nil {
+		sb.nbytes = uint64(fi.Size())
+	}
+	if sb.nbytes == 0 {
+		if err := setFilePerms(file); err != nil {
+			return err
+		}
+	}
+	sb.Writer = bufio.NewWriterSize(sb.file, bufferSize)
+
+	n, err := sb.file.Write(fileHeader(now, pn))
+	sb.nbytes += uint64(n)
+	scheduleCleanup(filepath.Dir(sb.path))
+	if sb.sink != nil {
+		sb.sink.reserveSpace(filepath.Dir(sb.path))
+	}
+	return err
+}
+
+// renameFile renames the -log_file file.  Tests replace it to make renaming
+// fail.
+var renameFile = os.Rename
+
+// numberedNameRE matches the suffix of the numbered siblings of a -log_file
+// file, possibly compressed.
+var numberedNameRE = regexp.MustCompile(`^\.(\d+)(?:\.[^.]+)?$`)
+
+// nextNumberedName returns path followed by a period and the number after the
+// highest one among its existing numbered siblings.
+func nextNumberedName(path string) string {
+	next := 1
+	base := filepath.Base(path)
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		if sm := numberedNameRE.FindStringSubmatch(name[len(base):]); sm != nil {
+			if n, err := strconv.Atoi(sm[1]); err == nil && n >= next {
+				next = n + 1
+			}
+		}
+	}
+	return fmt.Sprintf("%s.%d", path, next)
+}
+
+// fileFooter returns the footer written at the end of a log file that is
+// continued in the file named next.
+//
+// The text footer ends with the constant string \nCONTINUED IN NEXT FILE\n to
+// make continuation detection simple.
+func fileFooter(next string) []byte {
+	if jsonFiles() {
+		b, _ := json.Marshal(struct {
+			Next string `json:"next_log"`
+		}{next})
+		return append(b, '\n')
+	}
+	return []byte("Next log: " + next + footer)
+}
+
 // bufferSize sizes the buffer associated with each log file. It's large
 // so that log records can accumulate without the logging thread blocking
 // on disk I/O. The flushDaemon will block instead.
 const bufferSize = 256 * 1024
 
-// createMissingFiles creates all the log files for severity from infoLog up to
-// upTo that have not already been created.
-// s.mu is held.
-func (s *fileSink) createMissingFiles(upTo logsink.Severity) error {
-	if s.file[upTo] != nil {
-		return nil
+// fileSeverities returns the severities of the log files to which entries of
+// severity sev are written, as a bit mask with bit s set for severity s: by
+// default that of sev and all lower ones, subject to -log_file_severities.
+// With -one_output, only the highest of them is included, so that each entry
+// is written once.
+func fileSeverities(sev logsink.Severity) uint32 {
+	var sevs uint32
+	for ; sev >= logsink.Info; sev-- {
+		if !logFileSeverities.has(sev) {
+			continue
+		}
+		sevs |= 1 << sev
+		if oneOutput {
+			break
+		}
 	}
+	return sevs
+}
+
+// createMissingFiles creates the log files for the severities in the bit mask
+// sevs that have not already been created.
+// s.mu is held.
+func (s *fileSink) createMissingFiles(sevs uint32) error {
 	now := time.Now()
-	// Files are created in increasing severity order, so we can be assured that
-	// if a high severity logfile exists, then so do all of lower severity.
-	for sev := logsink.Info; sev <= upTo; sev++ {
-		if s.file[sev] != nil {
+	for sev := logsink.Info; sev <= logsink.Fatal; sev++ {
+		if sevs&(1<<sev) == 0 || s.file[sev] != nil {
 			continue
 		}
 		sb := &syncBuffer{
@@ -372,22 +677,42 @@ func (s *fileSink) createMissingFiles(upTo logsink.Severity) error {
 	return nil
 }
 
-// flushDaemon periodically flushes the log file buffers.
-func (s *fileSink) flushDaemon() {
-	tick := time.NewTicker(30 * time.Second)
-	defer tick.Stop()
+// startFlushDaemon starts a flushDaemon goroutine.
+// s.mu is held, or s is not yet in use.
+func (s *fileSink) startFlushDaemon() {
+	s.stopFlush = make(chan struct{})
+	s.flushStopped = make(chan struct{})
+	go s.flushDaemon(flushInterval(), s.stopFlush, s.flushStopped)
+}
+
+// flushDaemon periodically flushes the log file buffers, first after interval
+// then every -log_flush_interval, until stop is closed.  It then closes
+// stopped.
+func (s *fileSink) flushDaemon(interval time.Duration, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
 	for {
 		select {
-		case <-tick.C:
+		case <-timer.C:
 			s.Flush()
+			if *logDetectRotation {
+				s.reopenRotated()
+			}
+			s.checkLogDirs()
+			timer.Reset(flushInterval())
 		case sev := <-s.flushChan:
 			s.flush(sev)
+		case <-stop:
+			return
 		}
 	}
 }
 
-// Flush flushes all pending log I/O.
+// Flush flushes all pending log I/O, including entries queued for
+// asynchronous sinks.
 func Flush() {
+	drainAsyncSinks()
 	sinks.file.Flush()
 }
 
@@ -407,22 +732,26 @@ func (s *fileSink) flush(threshold logsink.Severity) error {
 
 	// Remember where we flushed, so we can call sync without holding
 	// the lock.
-	var files []flushSyncWriter
+	var files []syncer
 	func() {
 		s.mu.Lock()
 		defer s.mu.Unlock()
+		var flushed []flushSyncWriter
+		if s.single != nil {
+			updateErr(s.single.Flush())
+			flushed = append(flushed, s.single)
+		}
 		// Flush from fatal down, in case there's trouble flushing.
 		for sev := logsink.Fatal; sev >= threshold; sev-- {
 			if file := s.file[sev]; file != nil {
 				updateErr(file.Flush())
-				files = append(files, file)
+				flushed = append(flushed, file)
 			}
 		}
+		files = syncers(flushed)
 	}()
 
-	for _, file := range files {
-		updateErr(file.Sync())
-	}
+	updateErr(syncFiles(files))
 
 	return firstErr
 }
@@ -431,7 +760,8 @@ func (s *fileSink) flush(threshold logsink.Severity) error {
 // WARNING, or INFO logs. Returns ErrNoLog if the log for the given
 // level doesn't exist (e.g. because no messages of that level have been
 // written). This may return multiple names if the log type requested
-// has rolled over.
+// has rolled over.  Once a rotated file has been compressed (see
+// -log_compress), its compressed name is returned.
 func Names(s string) ([]string, error) {
 	severity, err := logsink.ParseSeverity(s)
 	if err != nil {
@@ -440,6 +770,9 @@ func Names(s string) ([]string, error) {
 
 	sinks.file.mu.Lock()
 	defer sinks.file.mu.Unlock()
+	if sb := sinks.file.single; sb != nil {
+		return sb.filenames(), nil
+	}
 	f := sinks.file.file[severity]
 	if f == nil {
 		return nil, ErrNoLog
@@ -2,7 +2,10 @@
 
 package glog
 
-import "os/user"
+import (
+	"os/user"
+	"strconv"
+)
 
 // shouldRegisterStderrSink determines whether we should register a log sink that writes to stderr.
 // Today, this always returns true on non-Windows platforms, as it specifically checks for a
@@ -17,3 +20,18 @@ func lookupUser() string {
 	}
 	return ""
 }
+
+// lookupGroup returns the id of the group with the given name or numeric id.
+func lookupGroup(name string) (int, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		if _, numErr := strconv.Atoi(name); numErr != nil {
+			return 0, err
+		}
+		if g, err = user.LookupGroupId(name); err != nil {
+			// The group may exist without an entry in the group database.
+			return strconv.Atoi(name)
+		}
+	}
+	return strconv.Atoi(g.Gid)
+}
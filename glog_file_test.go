@@ -0,0 +1,419 @@
+package glog
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+// setLogFile sets -log_file to path for the duration of a test.
+func setLogFile(t *testing.T, path string) {
+	t.Helper()
+	previous := *logFile
+	*logFile = path
+	t.Cleanup(func() {
+		*logFile = previous
+		sinks.file.mu.Lock()
+		defer sinks.file.mu.Unlock()
+		if sb := sinks.file.single; sb != nil {
+			sb.file.Close()
+		}
+		sinks.file.single = nil
+	})
+}
+
+func TestLogFile(t *testing.T) {
+	setFlags()
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("old entry\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".7.gz", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	setLogFile(t, path)
+
+	Info("first")
+	Error("second")
+	sinks.file.Flush()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"old entry\n", "] first\n", "] second\n"} {
+		if strings.Count(string(b), s) != 1 {
+			t.Errorf("%s has contents:\n%s\nwant %q once", path, b, s)
+		}
+	}
+
+	// Force a rotation.
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	fakeNow := time.Now().Add(2 * time.Second)
+	timeNow = func() time.Time { return fakeNow }
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 1
+
+	Warning("third")
+	sinks.file.Flush()
+	rotated := path + ".8"
+	b, err = os.ReadFile(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "] second\n") || !strings.HasSuffix(string(b), "Next log: "+path+footer) {
+		t.Errorf("%s has contents:\n%s\nwant the old entries and a footer naming %s", rotated, b, path)
+	}
+	b, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "Previous log: "+rotated+"\n") || !strings.HasSuffix(string(b), "] third\n") {
+		t.Errorf("%s has contents:\n%s\nwant a header naming %s and the new entry", path, b, rotated)
+	}
+
+	names, err := Names("FATAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{rotated, path}; strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("Names(FATAL) = %v, want %v", names, want)
+	}
+}
+
+func TestLogFileRenameFails(t *testing.T) {
+	setFlags()
+	path := filepath.Join(t.TempDir(), "app.log")
+	setLogFile(t, path)
+	Info("first")
+	sinks.file.Flush()
+
+	defer func(previous func(string, string) error) { renameFile = previous }(renameFile)
+	renameFile = func(string, string) error { return errors.New("rename failed") }
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 1
+	Warning("second")
+
+	b := readLog(t, path)
+	if n := strings.Count(b, "Log file created at:"); n != 1 || strings.Contains(b, "Next log:") {
+		t.Errorf("%s has %d headers after a failed rename, and contents:\n%s\nwant one header and no footer", path, n, b)
+	}
+	if !strings.Contains(b, "] first\n") || !strings.HasSuffix(b, "] second\n") {
+		t.Errorf("%s has contents:\n%s\nwant both entries", path, b)
+	}
+}
+
+// readLog flushes the log files and returns the contents of path.
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	sinks.file.Flush()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestReopen(t *testing.T) {
+	setFlags()
+	path := filepath.Join(t.TempDir(), "app.log")
+	setLogFile(t, path)
+
+	Info("before rename")
+	readLog(t, path)
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	Info("buffered before reopen")
+	if err := Reopen(); err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	Info("after reopen")
+
+	if got := readLog(t, path+".old"); !strings.Contains(got, "] before rename\n") || !strings.Contains(got, "] buffered before reopen\n") {
+		t.Errorf("renamed file has contents:\n%s\nwant the entries logged before Reopen", got)
+	}
+	if got := readLog(t, path); !strings.HasPrefix(got, "Log file created at: ") || !strings.HasSuffix(got, "] after reopen\n") {
+		t.Errorf("reopened file has contents:\n%s\nwant a header and the entry logged after Reopen", got)
+	}
+}
+
+func TestReopenRotated(t *testing.T) {
+	setFlags()
+	path := filepath.Join(t.TempDir(), "app.log")
+	setLogFile(t, path)
+
+	Info("first")
+	readLog(t, path)
+	sinks.file.reopenRotated()
+	Info("second")
+	if got := readLog(t, path); strings.Count(got, "Log file created at: ") != 1 {
+		t.Errorf("file has contents:\n%s\nwant it not to be reopened", got)
+	}
+
+	// As logrotate's copytruncate option does.
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	sinks.file.reopenRotated()
+	Info("after truncation")
+	if got := readLog(t, path); !strings.HasPrefix(got, "Log file created at: ") || strings.Contains(got, "] second\n") {
+		t.Errorf("truncated file has contents:\n%q\nwant a new header and only new entries", got)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	sinks.file.reopenRotated()
+	Info("after removal")
+	if got := readLog(t, path); !strings.HasSuffix(got, "] after removal\n") {
+		t.Errorf("recreated file has contents:\n%s\nwant the new entry", got)
+	}
+}
+
+func TestReopenTruncatedSeverityFile(t *testing.T) {
+	setFlags()
+	useLogDir(t, t.TempDir())
+
+	Info("first")
+	sinks.file.Flush()
+	sinks.file.mu.Lock()
+	name := sinks.file.file[logsink.Info].(*syncBuffer).file.Name()
+	sinks.file.mu.Unlock()
+
+	Info("second")
+	// As logrotate's copytruncate option does, without reopening the file.
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	Info("third")
+	got := readLog(t, name)
+	if strings.Contains(got, "\x00") || !strings.HasPrefix(got, "I") || !strings.HasSuffix(got, "] third\n") {
+		t.Errorf("truncated file has contents:\n%q\nwant the entries logged since, without a hole", got)
+	}
+
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	Info("buffered")
+	sinks.file.reopenRotated()
+	Info("after reopen")
+	got = readLog(t, name)
+	if !strings.HasPrefix(got, "Log file created at: ") || strings.Count(got, "Log file created at: ") != 1 ||
+		!strings.Contains(got, "] buffered\n") || !strings.HasSuffix(got, "] after reopen\n") {
+		t.Errorf("reopened file has contents:\n%q\nwant a header followed by the entries logged since truncation", got)
+	}
+}
+
+func TestReopenSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not reliably supported on Windows")
+	}
+	setFlags()
+	dir := t.TempDir()
+	useLogDir(t, dir)
+	Info("first")
+	sinks.file.Flush()
+	sinks.file.mu.Lock()
+	name := sinks.file.file[logsink.Info].(*syncBuffer).file.Name()
+	sinks.file.mu.Unlock()
+
+	target := filepath.Join(dir, "target")
+	if err := os.WriteFile(target, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, name); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reopen(); err == nil {
+		t.Error("Reopen() = nil, want an error for a symlink in place of a log file")
+	}
+	Info("second")
+	sinks.file.Flush()
+	if b, err := os.ReadFile(target); err != nil || len(b) != 0 {
+		t.Errorf("os.ReadFile(%s) = %q, %v, want the symlink target left empty", target, b, err)
+	}
+}
+
+func TestReopenSymlinkedLogFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not reliably supported on Windows")
+	}
+	setFlags()
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.log")
+	path := filepath.Join(dir, "app.log")
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+	setLogFile(t, path)
+	Info("first")
+	readLog(t, path)
+
+	if err := Reopen(); err != nil {
+		t.Fatalf("Reopen() = %v, want nil for a -log_file that is a symlink", err)
+	}
+	Info("second")
+	if got := readLog(t, target); !strings.Contains(got, "] first\n") || !strings.HasSuffix(got, "] second\n") {
+		t.Errorf("symlink target has contents:\n%s\nwant the entries logged before and after Reopen", got)
+	}
+}
+
+func TestCreateErrorWraps(t *testing.T) {
+	defer func(previous bool) { *logDirCreate = previous }(*logDirCreate)
+	*logDirCreate = false
+	_, _, err := create("INFO", time.Now(), filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("create in a missing directory: %v, want an error wrapping os.ErrNotExist", err)
+	}
+}
+
+func TestLogFilePerms(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes and groups are not supported on Windows")
+	}
+	setTemplates(t, "logs/{program}.{tag}.{seq}", "")
+	defer logFileMode.Set("")
+	defer logFileGroup.Set("")
+	if err := flag.Lookup("log_file_mode").Value.Set("0640"); err != nil {
+		t.Fatal(err)
+	}
+	if err := flag.Lookup("log_file_group").Value.Set(strconv.Itoa(os.Getgid())); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	f, name, err := create("INFO", time.Now(), dir)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	f.Close()
+	for _, tc := range []struct {
+		path string
+		want os.FileMode
+	}{
+		{name, 0640},
+		{filepath.Dir(name), os.ModeDir | 0750},
+	} {
+		fi, err := os.Stat(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fi.Mode(); got != tc.want {
+			t.Errorf("mode of %s = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct{ flag, value string }{
+		{"log_file_mode", "0644x"},
+		{"log_file_mode", "01777"},
+		{"log_file_group", "no such group"},
+	} {
+		if err := flag.Lookup(tc.flag).Value.Set(tc.value); err == nil {
+			t.Errorf("-%s=%q accepted, want error", tc.flag, tc.value)
+		}
+	}
+}
+
+// syncCountingBuffer is a flushSyncWriter that counts calls to Sync, and
+// records whether the file sink was locked during any of them.
+type syncCountingBuffer struct {
+	flushBuffer
+	syncs  atomic.Int32
+	locked atomic.Bool
+}
+
+func (b *syncCountingBuffer) Sync() error {
+	b.syncs.Add(1)
+	// Other goroutines only hold the lock briefly, unlike a caller of Sync.
+	for deadline := time.Now().Add(time.Second); !sinks.file.mu.TryLock(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			b.locked.Store(true)
+			return nil
+		}
+	}
+	sinks.file.mu.Unlock()
+	return nil
+}
+
+func TestSyncSeverity(t *testing.T) {
+	setFlags()
+	var bufs [4]*syncCountingBuffer
+	var writers severityWriters
+	for i := range bufs {
+		bufs[i] = new(syncCountingBuffer)
+		writers[i] = bufs[i]
+	}
+	defer sinks.file.swap(sinks.file.swap(writers))
+	defer logSyncSeverity.Set("")
+	// Keep the flush daemon from syncing the files.
+	defer func(previous int) { *logBufLevel = previous }(*logBufLevel)
+	*logBufLevel = int(logsink.Fatal)
+	if err := flag.Lookup("log_sync_severity").Value.Set("ERROR"); err != nil {
+		t.Fatal(err)
+	}
+
+	Warning("not synced")
+	if got := bufs[logsink.Info].syncs.Load() + bufs[logsink.Warning].syncs.Load(); got != 0 {
+		t.Errorf("WARNING entry synced %d files, want 0", got)
+	}
+	Error("synced")
+	for sev := logsink.Info; sev <= logsink.Error; sev++ {
+		if got := bufs[sev].syncs.Load(); got != 1 {
+			t.Errorf("ERROR entry synced the %v file %d times, want 1", sev, got)
+		}
+		if bufs[sev].locked.Load() {
+			t.Errorf("ERROR entry synced the %v file while holding the file sink lock", sev)
+		}
+	}
+
+	if err := flag.Lookup("log_sync_severity").Value.Set("LOUD"); err == nil {
+		t.Error("-log_sync_severity=LOUD accepted, want error")
+	}
+}
+
+// Test that entries synced because of -log_sync_severity do not fail when
+// other goroutines rotate the files they were written to.
+func TestSyncSeverityWhileRotating(t *testing.T) {
+	setFlags()
+	useLogDir(t, t.TempDir())
+	defer logSyncSeverity.Set("")
+	if err := flag.Lookup("log_sync_severity").Value.Set("ERROR"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 4096
+	// Advance the clock on every call, so that files may be rotated at once.
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	var ticks atomic.Int64
+	start := time.Now()
+	timeNow = func() time.Time { return start.Add(time.Duration(ticks.Add(1)) * time.Second) }
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry := []byte(strings.Repeat("x", 200) + "\n")
+			for i := 0; i < 50; i++ {
+				if _, err := sinks.file.Emit(&logsink.Meta{Time: start, Severity: logsink.Error}, entry); err != nil {
+					t.Errorf("Emit: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -3,6 +3,7 @@
 package glog
 
 import (
+	"errors"
 	"os"
 	"syscall"
 )
@@ -41,3 +42,9 @@ func lookupUser() string {
 	}
 	return username
 }
+
+// lookupGroup returns an error: Windows files have no owning group that
+// os.Chown could set.
+func lookupGroup(name string) (int, error) {
+	return 0, errors.New("log file groups are not supported on Windows")
+}
@@ -222,6 +222,16 @@ func (f *verboseFlags) enabled(callerDepth int, level Level) bool {
 	if runtime.Callers(callerDepth+2, pcs[:]) < 1 {
 		return false
 	}
+	return f.enabledPC(pcs[0], level)
+}
+
+// enabledPC acts as enabled, but checks -vmodule for the function containing
+// the given program counter instead of walking the stack.
+func (f *verboseFlags) enabledPC(pc uintptr, level Level) bool {
+	if atomic.LoadInt32(&f.moduleLength) == 0 || pc == 0 {
+		return Level(atomic.LoadInt32((*int32)(&f.v))) >= level
+	}
+	pcs := [1]uintptr{pc}
 	frame, _ := runtime.CallersFrames(pcs[:]).Next()
 	return f.levelForPC(frame.Entry) >= level
 }
@@ -355,6 +365,216 @@ func (s *severityFlag) Set(value string) error {
 	return nil
 }
 
+// logFormats are the Formatters that can be selected with -log_format.
+var logFormats = [...]struct {
+	name string
+	f    logsink.Formatter
+}{
+	{"glog", logsink.GlogFormatter},
+	{"json", logsink.JSONFormatter},
+}
+
+// formatFlag is an atomic flag.Value implementation holding an index into
+// logFormats.
+type formatFlag int32
+
+// get returns the Formatter selected by the flag.
+func (f *formatFlag) get() logsink.Formatter {
+	return logFormats[atomic.LoadInt32((*int32)(f))].f
+}
+func (f *formatFlag) String() string { return logFormats[atomic.LoadInt32((*int32)(f))].name }
+func (f *formatFlag) Get() any       { return f.get() }
+func (f *formatFlag) Set(value string) error {
+	for i, lf := range logFormats {
+		if strings.EqualFold(value, lf.name) {
+			atomic.StoreInt32((*int32)(f), int32(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log format %q (want glog or json)", value)
+}
+
+// severitySet is an atomic flag.Value implementation for the
+// -log_file_severities flag.  It is a bit mask of severities, with bit s set
+// for severity s; zero means all of them.
+type severitySet uint32
+
+func (f *severitySet) get() uint32 {
+	if mask := atomic.LoadUint32((*uint32)(f)); mask != 0 {
+		return mask
+	}
+	return 1<<(logsink.Fatal+1) - 1
+}
+
+func (f *severitySet) has(s logsink.Severity) bool { return f.get()&(1<<s) != 0 }
+
+func (f *severitySet) String() string {
+	var names []string
+	for s := logsink.Info; s <= logsink.Fatal; s++ {
+		if f.has(s) {
+			names = append(names, s.String())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *severitySet) Get() any { return f.get() }
+
+func (f *severitySet) Set(value string) error {
+	var mask uint32
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		s, err := logsink.ParseSeverity(name)
+		if err != nil {
+			return err
+		}
+		mask |= 1 << s
+	}
+	atomic.StoreUint32((*uint32)(f), mask)
+	return nil
+}
+
+// syncSeverityFlag is an atomic flag.Value implementation for the
+// -log_sync_severity flag.  It holds one more than the lowest severity of the
+// entries synced to disk before the logging call returns, or zero if none are.
+type syncSeverityFlag int32
+
+// get returns the lowest severity of the entries to sync, and whether there is
+// one.
+func (f *syncSeverityFlag) get() (logsink.Severity, bool) {
+	v := atomic.LoadInt32((*int32)(f))
+	return logsink.Severity(v - 1), v != 0
+}
+
+func (f *syncSeverityFlag) String() string {
+	if s, ok := f.get(); ok {
+		return s.String()
+	}
+	return "NONE"
+}
+
+func (f *syncSeverityFlag) Get() any { return f.String() }
+
+func (f *syncSeverityFlag) Set(value string) error {
+	if strings.EqualFold(value, "none") || value == "" {
+		atomic.StoreInt32((*int32)(f), 0)
+		return nil
+	}
+	var s severityFlag
+	if err := s.Set(value); err != nil {
+		return err
+	}
+	atomic.StoreInt32((*int32)(f), int32(s.get())+1)
+	return nil
+}
+
+// choiceFlag is a flag.Value implementation for flags whose value is either
+// empty or one of a fixed set of strings, matched case-insensitively.
+type choiceFlag struct {
+	choices []string
+
+	mu    sync.Mutex
+	value string
+}
+
+func (f *choiceFlag) get() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.value
+}
+
+func (f *choiceFlag) String() string { return f.get() }
+func (f *choiceFlag) Get() any       { return f.get() }
+
+func (f *choiceFlag) Set(value string) error {
+	value = strings.ToLower(value)
+	valid := value == ""
+	for _, c := range f.choices {
+		valid = valid || c == value
+	}
+	if !valid {
+		return fmt.Errorf("unknown value %q (want %s)", value, strings.Join(f.choices, " or "))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.value = value
+	return nil
+}
+
+// sinkErrorPolicy is an atomic flag.Value implementation for the
+// -log_sink_error_policy flag, selecting what happens when a sink returns an
+// error.
+type sinkErrorPolicy int32
+
+const (
+	abortOnSinkError   sinkErrorPolicy = iota // Log a FATAL message and abort.
+	disableOnSinkError                        // Stop writing to the sink.
+	stderrOnSinkError                         // Stop writing to the sink and log everything to stderr.
+	retryOnSinkError                          // Stop writing to the sink for an increasing interval.
+)
+
+var sinkErrorPolicyNames = [...]string{
+	abortOnSinkError:   "abort",
+	disableOnSinkError: "disable",
+	stderrOnSinkError:  "stderr",
+	retryOnSinkError:   "retry",
+}
+
+func (p *sinkErrorPolicy) get() sinkErrorPolicy {
+	return sinkErrorPolicy(atomic.LoadInt32((*int32)(p)))
+}
+func (p *sinkErrorPolicy) String() string { return sinkErrorPolicyNames[p.get()] }
+func (p *sinkErrorPolicy) Get() any       { return p.get() }
+func (p *sinkErrorPolicy) Set(value string) error {
+	for i, name := range sinkErrorPolicyNames {
+		if strings.EqualFold(value, name) {
+			atomic.StoreInt32((*int32)(p), int32(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown sink error policy %q (want abort, disable, stderr or retry)", value)
+}
+
+var multilineModeNames = [...]string{
+	logsink.MultilineRaw:    "raw",
+	logsink.MultilinePrefix: "prefix",
+	logsink.MultilineEscape: "escape",
+}
+
+// multilineFlag is the flag.Value for the -log_multiline flag, which sets the
+// logsink.MultilineMode.
+type multilineFlag struct{}
+
+func (multilineFlag) String() string { return multilineModeNames[logsink.GetMultilineMode()] }
+func (multilineFlag) Get() any       { return logsink.GetMultilineMode() }
+func (multilineFlag) Set(value string) error {
+	for i, name := range multilineModeNames {
+		if strings.EqualFold(value, name) {
+			logsink.SetMultilineMode(logsink.MultilineMode(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown multiline mode %q (want raw, prefix or escape)", value)
+}
+
+// escapeControlFlag is the flag.Value for the -log_escape_control_chars flag,
+// which calls logsink.SetEscapeControlChars.
+type escapeControlFlag struct{}
+
+func (escapeControlFlag) IsBoolFlag() bool { return true }
+func (escapeControlFlag) String() string   { return strconv.FormatBool(logsink.EscapingControlChars()) }
+func (escapeControlFlag) Get() any         { return logsink.EscapingControlChars() }
+func (escapeControlFlag) Set(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	logsink.SetEscapeControlChars(enabled)
+	return nil
+}
+
 var (
 	vflags verboseFlags // The -v and -vmodule flags.
 
@@ -365,8 +585,17 @@ var (
 	// compatibility. TODO: does this matter enough to fix? Seems unlikely.
 	toStderr     bool // The -logtostderr flag.
 	alsoToStderr bool // The -alsologtostderr flag.
+	oneOutput    bool // The -one_output flag.
 
 	stderrThreshold severityFlag // The -stderrthreshold flag.
+
+	logFileSeverities severitySet // The -log_file_severities flag.
+
+	logSyncSeverity syncSeverityFlag // The -log_sync_severity flag.
+
+	logFormat formatFlag // The -log_format flag.
+
+	sinkErrPolicy sinkErrorPolicy // The -log_sink_error_policy flag.
 )
 
 // verboseEnabled returns whether the caller at the given depth should emit
@@ -385,14 +614,21 @@ func backtraceAt(file string, line int) bool {
 func init() {
 	vflags.moduleLevelCache.Store(&sync.Map{})
 
-	flag.Var(&vflags.v, "v", "log level for V logs")
-	flag.Var(vModuleFlag{&vflags}, "vmodule", "comma-separated list of pattern=N settings for file-filtered logging")
+	flag.Var(&vflags.v, glogFlag("v"), "log level for V logs")
+	flag.Var(vModuleFlag{&vflags}, glogFlag("vmodule"), "comma-separated list of pattern=N settings for file-filtered logging")
 
-	flag.Var(&logBacktraceAt, "log_backtrace_at", "when logging hits line file:N, emit a stack trace")
+	flag.Var(&logBacktraceAt, glogFlag("log_backtrace_at"), "when logging hits line file:N, emit a stack trace")
 
 	stderrThreshold = severityFlag(logsink.Error)
 
-	flag.BoolVar(&toStderr, "logtostderr", false, "log to standard error instead of files")
-	flag.BoolVar(&alsoToStderr, "alsologtostderr", false, "log to standard error as well as files")
-	flag.Var(&stderrThreshold, "stderrthreshold", "logs at or above this threshold go to stderr")
+	flag.BoolVar(&toStderr, glogFlag("logtostderr"), false, "log to standard error instead of files")
+	flag.BoolVar(&alsoToStderr, glogFlag("alsologtostderr"), false, "log to standard error as well as files")
+	flag.Var(&stderrThreshold, glogFlag("stderrthreshold"), "logs at or above this threshold go to stderr")
+	flag.Var(&logSyncSeverity, glogFlag("log_sync_severity"), "log entries at or above this severity are flushed and synced to disk before the logging call returns (default none)")
+	flag.Var(&logFileSeverities, glogFlag("log_file_severities"), "comma-separated list of the severities whose log files are written, such as INFO,ERROR (default all)")
+	flag.BoolVar(&oneOutput, glogFlag("one_output"), false, "write each log entry only to the file of its severity (or the nearest lower one written), rather than to those of all lower severities too")
+	flag.Var(&logFormat, glogFlag("log_format"), "format of log entries written to files and stderr: glog or json")
+	flag.Var(multilineFlag{}, glogFlag("log_multiline"), "how to write log entries that span several lines: raw, prefix (repeat the header on each line) or escape (encode newlines as \\n)")
+	flag.Var(escapeControlFlag{}, glogFlag("log_escape_control_chars"), "escape control characters, such as newlines and terminal escape sequences, in log messages written to files and stderr")
+	flag.Var(&sinkErrPolicy, glogFlag("log_sink_error_policy"), "what to do when writing to a log sink fails: abort, disable, stderr or retry")
 }
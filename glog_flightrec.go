@@ -0,0 +1,305 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The memory-mapped flight recorder file.
+
+package glog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+var logFlightRecorderSize = flag.Uint64(glogFlag("log_flight_recorder_size"), 0, "If positive, also write every log entry to a memory-mapped ring file of this many bytes in the log directory, which survives the process being killed")
+
+// The layout of a flight recorder file.  The file starts with a header holding
+// flightMagic and the size of the ring that follows it.  The ring holds
+// records, each aligned to recordAlign bytes, made of a recordHeaderSize-byte
+// header followed by a log entry: recordMagic, the length of the entry, its
+// sequence number and the CRC-32 of the sequence number and entry, in little
+// endian.  A record that does not fit before the end of the ring is written at
+// its start instead, overwriting the oldest records.
+const (
+	flightMagic      = "GLOGFLT1"
+	flightHeaderSize = 16
+	recordMagic      = 0x474c4f47
+	recordHeaderSize = 24
+	recordAlign      = 8
+	minFlightSize    = 4096
+)
+
+// flightRecorderSink is a logsink.Text that writes every log entry it receives
+// to the ring of a memory-mapped file.  Since the kernel owns the pages of the
+// mapping, the entries reach the file even if the process dies abruptly, such
+// as when it is killed by the OOM killer, without ever being flushed.
+type flightRecorderSink struct {
+	mu      sync.Mutex
+	opened  bool   // Whether open has been attempted, or the file closed.
+	mapping []byte // The mapped file, nil if it is not open.
+	ring    []byte // The ring in mapping.
+	name    string
+	pos     int    // The offset in the ring of the next record.
+	seq     uint64 // The sequence number of the last record.
+}
+
+func init() {
+	logsink.TextSinks = append(logsink.TextSinks, &sinks.flight)
+}
+
+// Enabled implements logsink.Text.Enabled.  It returns true if
+// -log_flight_recorder_size is positive and the file could be created.
+func (s *flightRecorderSink) Enabled(m *logsink.Meta) bool {
+	if *logFlightRecorderSize == 0 || !builtinSinksEnabled() {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.opened || s.ring != nil
+}
+
+// Formatter implements logsink.CustomFormatter.Formatter.  The flight recorder
+// always holds glog text, whatever -log_format is.
+func (s *flightRecorderSink) Formatter(m *logsink.Meta) logsink.Formatter {
+	return logsink.GlogFormatter
+}
+
+// Emit implements logsink.Text.Emit.
+func (s *flightRecorderSink) Emit(m *logsink.Meta, data []byte) (n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.opened {
+		s.opened = true
+		if err := s.open(m.Time); err != nil {
+			// Failing to record is not worth failing the logging call for;
+			// the message is logged by another goroutine as s.mu is held.
+			go Errorf("log: cannot create flight recorder file: %v", err)
+		}
+	}
+	if s.ring == nil {
+		return 0, nil
+	}
+	s.write(data)
+	return len(data), nil
+}
+
+// open creates and maps the flight recorder file in the first log directory
+// in which that succeeds.
+// s.mu is held.
+func (s *flightRecorderSink) open(now time.Time) error {
+	size := int(*logFlightRecorderSize)
+	if size < minFlightSize {
+		size = minFlightSize
+	}
+	size = (size + recordAlign - 1) &^ (recordAlign - 1)
+	name := fmt.Sprintf("%s.%s.%s.flight.%04d%02d%02d-%02d%02d%02d.%d",
+		program, host, userName,
+		now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second(),
+		pid)
+
+	// The log directories are chosen, and chosen again by RestartFileSink,
+	// with sinks.file.mu held.
+	sinks.file.mu.Lock()
+	onceLogDirs.Do(createLogDirs)
+	dirs := logDirs
+	sinks.file.mu.Unlock()
+
+	var errs []error
+	for _, dir := range dirs {
+		fname := filepath.Join(dir, name)
+		mapping, err := createFlightFile(fname, size)
+		if err == nil {
+			s.name, s.mapping, s.ring = fname, mapping, mapping[flightHeaderSize:]
+			scheduleCleanup(dir)
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return logsink.JoinErrors(errs...)
+}
+
+// close unmaps the flight recorder file.  No new file is created until reset
+// is called.
+func (s *flightRecorderSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opened = true
+	return s.unmap()
+}
+
+// reset unmaps the flight recorder file, so that a new one is created in the
+// log directory when an entry is next logged.
+func (s *flightRecorderSink) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unmap()
+	s.opened = false
+	s.name, s.pos, s.seq = "", 0, 0
+}
+
+// unmap unmaps the flight recorder file, if it is mapped.
+// s.mu is held.
+func (s *flightRecorderSink) unmap() error {
+	if s.mapping == nil {
+		return nil
+	}
+	err := unmapFlightFile(s.mapping)
+	s.mapping, s.ring = nil, nil
+	return err
+}
+
+// openFile returns the name of the flight recorder file if it is open,
+// or "".
+func (s *flightRecorderSink) openFile() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mapping == nil {
+		return ""
+	}
+	return s.name
+}
+
+// flightSuffixRE matches the end of the name of a flight recorder file, after
+// its program, host, user and "flight".
+var flightSuffixRE = regexp.MustCompile(`^\.\d{8}-\d{6}\.\d+$`)
+
+// isFlightFile reports whether name is that of a flight recorder file of this
+// program, host and user.
+func isFlightFile(name string) bool {
+	prefix := program + "." + host + "." + userName + ".flight"
+	return strings.HasPrefix(name, prefix) && flightSuffixRE.MatchString(name[len(prefix):])
+}
+
+// createFlightFile creates the file fname, large enough for a ring of size
+// bytes, writes its header, and maps the whole file into memory.
+func createFlightFile(fname string, size int) ([]byte, error) {
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_EXCL, newFileMode())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // The mapping outlives the file descriptor.
+	var header [flightHeaderSize]byte
+	copy(header[:], flightMagic)
+	binary.LittleEndian.PutUint64(header[8:], uint64(size))
+	err = setFilePerms(f)
+	if err == nil {
+		err = f.Truncate(int64(flightHeaderSize + size))
+	}
+	if err == nil {
+		_, err = f.WriteAt(header[:], 0)
+	}
+	var mapping []byte
+	if err == nil {
+		mapping, err = mapFlightFile(f, flightHeaderSize+size)
+	}
+	if err != nil {
+		os.Remove(fname)
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// write adds a record holding data to the ring, truncating data if it does not
+// fit in the ring on its own.
+func (s *flightRecorderSink) write(data []byte) {
+	if max := len(s.ring) - recordHeaderSize; len(data) > max {
+		data = data[:max]
+	}
+	size := (recordHeaderSize + len(data) + recordAlign - 1) &^ (recordAlign - 1)
+	if s.pos+size > len(s.ring) {
+		s.pos = 0
+	}
+	s.seq++
+	r := s.ring[s.pos : s.pos+size]
+	// Invalidate the record being overwritten before filling in the new one,
+	// so that a crash in between cannot leave a record mixing both.
+	binary.LittleEndian.PutUint32(r[0:], 0)
+	binary.LittleEndian.PutUint32(r[4:], uint32(len(data)))
+	binary.LittleEndian.PutUint64(r[8:], s.seq)
+	copy(r[recordHeaderSize:], data)
+	binary.LittleEndian.PutUint32(r[16:], recordChecksum(r[8:16], data))
+	binary.LittleEndian.PutUint32(r[0:], recordMagic)
+	s.pos += size
+}
+
+// recordChecksum returns the CRC-32 of a record's sequence number and data.
+func recordChecksum(seq, data []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(seq), crc32.IEEETable, data)
+}
+
+// DecodeFlightRecorder reads a file written because of -log_flight_recorder_size
+// from r and writes the log entries it still holds to w, oldest first, as glog
+// text.  Entries that were being written when the process died are skipped.
+func DecodeFlightRecorder(w io.Writer, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(b) < flightHeaderSize || string(b[:len(flightMagic)]) != flightMagic {
+		return errors.New("log: not a flight recorder file")
+	}
+	size := binary.LittleEndian.Uint64(b[8:])
+	if size > uint64(len(b)-flightHeaderSize) {
+		return fmt.Errorf("log: flight recorder file truncated to %d of %d bytes", len(b), flightHeaderSize+size)
+	}
+	ring := b[flightHeaderSize : flightHeaderSize+int(size)]
+
+	type record struct {
+		seq  uint64
+		data []byte
+	}
+	var records []record
+	for pos := 0; pos+recordHeaderSize <= len(ring); {
+		h := ring[pos : pos+recordHeaderSize]
+		n := int(binary.LittleEndian.Uint32(h[4:]))
+		if binary.LittleEndian.Uint32(h[0:]) != recordMagic || n > len(ring)-pos-recordHeaderSize {
+			pos += recordAlign
+			continue
+		}
+		data := ring[pos+recordHeaderSize : pos+recordHeaderSize+n]
+		if binary.LittleEndian.Uint32(h[16:]) != recordChecksum(h[8:16], data) {
+			pos += recordAlign
+			continue
+		}
+		records = append(records, record{seq: binary.LittleEndian.Uint64(h[8:]), data: data})
+		pos += (recordHeaderSize + n + recordAlign - 1) &^ (recordAlign - 1)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].seq < records[j].seq })
+
+	for _, r := range records {
+		data := r.data
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data[:len(data):len(data)], '\n')
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
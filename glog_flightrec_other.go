@@ -0,0 +1,19 @@
+//go:build !unix
+
+package glog
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFlightFile returns an error: the flight recorder is only supported on
+// Unix systems.
+func mapFlightFile(f *os.File, size int) ([]byte, error) {
+	return nil, errors.New("flight recorder files are not supported on this platform")
+}
+
+// unmapFlightFile does nothing, as mapFlightFile never maps a file.
+func unmapFlightFile(b []byte) error {
+	return nil
+}
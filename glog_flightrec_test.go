@@ -0,0 +1,197 @@
+//go:build unix
+
+package glog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+// flightEntries writes n entries to s, numbered from first, and returns them.
+func flightEntries(s *flightRecorderSink, first, n int) []string {
+	var entries []string
+	for i := first; i < first+n; i++ {
+		e := fmt.Sprintf("I entry %04d %s\n", i, strings.Repeat("x", i%50))
+		s.Emit(&logsink.Meta{Time: time.Now(), Severity: logsink.Info}, []byte(e))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func decodeFlightFile(t *testing.T, name string) string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var b bytes.Buffer
+	if err := DecodeFlightRecorder(&b, f); err != nil {
+		t.Fatalf("DecodeFlightRecorder(%s) = %v", name, err)
+	}
+	return b.String()
+}
+
+func TestFlightRecorder(t *testing.T) {
+	setFlags()
+	defer func(previous uint64) { *logFlightRecorderSize = previous }(*logFlightRecorderSize)
+	*logFlightRecorderSize = minFlightSize
+	dir := t.TempDir()
+	useLogDir(t, dir)
+
+	s := &flightRecorderSink{}
+	if !s.Enabled(&logsink.Meta{Severity: logsink.Info}) {
+		t.Fatal("Enabled() = false with -log_flight_recorder_size set, want true")
+	}
+	entries := flightEntries(s, 0, 500)
+	if filepath.Dir(s.name) != dir {
+		t.Fatalf("flight recorder file %s, want one in %s", s.name, dir)
+	}
+
+	// The file is read without any flush or unmapping, as after a crash.
+	got := decodeFlightFile(t, s.name)
+	if len(got) == 0 || len(got) > minFlightSize {
+		t.Fatalf("decoded %d bytes from a %d-byte ring", len(got), minFlightSize)
+	}
+	if want := strings.Join(entries, ""); !strings.HasSuffix(want, got) || !strings.HasPrefix(got, "I entry ") {
+		t.Errorf("decoded entries are not the latest ones in order:\n%s", got)
+	}
+}
+
+func TestFlightRecorderTornRecord(t *testing.T) {
+	setFlags()
+	defer func(previous uint64) { *logFlightRecorderSize = previous }(*logFlightRecorderSize)
+	*logFlightRecorderSize = minFlightSize
+	useLogDir(t, t.TempDir())
+
+	s := &flightRecorderSink{}
+	entries := flightEntries(s, 0, 3)
+	// Damage the second entry, as if the process had died while writing it.
+	i := bytes.Index(s.ring, []byte(entries[1]))
+	if i < 0 {
+		t.Fatalf("entry %q not found in the ring", entries[1])
+	}
+	s.ring[i+len(entries[1])-2] = 'y'
+
+	if got, want := decodeFlightFile(t, s.name), entries[0]+entries[2]; got != want {
+		t.Errorf("DecodeFlightRecorder() wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFlightRecorderLongEntry(t *testing.T) {
+	setFlags()
+	defer func(previous uint64) { *logFlightRecorderSize = previous }(*logFlightRecorderSize)
+	*logFlightRecorderSize = 1 // Rounded up to minFlightSize.
+	useLogDir(t, t.TempDir())
+
+	s := &flightRecorderSink{}
+	long := strings.Repeat("z", 2*minFlightSize) + "\n"
+	s.Emit(&logsink.Meta{Severity: logsink.Error}, []byte(long))
+
+	got := decodeFlightFile(t, s.name)
+	if want := long[:minFlightSize-recordHeaderSize] + "\n"; got != want {
+		t.Errorf("DecodeFlightRecorder() wrote %d bytes, want the first %d of the entry", len(got), len(want)-1)
+	}
+}
+
+func TestDecodeFlightRecorderErrors(t *testing.T) {
+	var b bytes.Buffer
+	if err := DecodeFlightRecorder(&b, strings.NewReader("not a flight recorder")); err == nil {
+		t.Error("DecodeFlightRecorder(garbage) = nil, want error")
+	}
+	header := flightMagic + "\x00\x10\x00\x00\x00\x00\x00\x00"
+	if err := DecodeFlightRecorder(&b, strings.NewReader(header)); err == nil {
+		t.Error("DecodeFlightRecorder(truncated file) = nil, want error")
+	}
+}
+
+func TestFlightRecorderDisabled(t *testing.T) {
+	defer func(previous uint64) { *logFlightRecorderSize = previous }(*logFlightRecorderSize)
+	*logFlightRecorderSize = 0
+	if sinks.flight.Enabled(&logsink.Meta{Severity: logsink.Fatal}) {
+		t.Error("Enabled() = true without -log_flight_recorder_size, want false")
+	}
+}
+
+func TestFlightRecorderShutdown(t *testing.T) {
+	setFlags()
+	defer func(previous uint64) { *logFlightRecorderSize = previous }(*logFlightRecorderSize)
+	*logFlightRecorderSize = minFlightSize
+	dir := t.TempDir()
+	useLogDir(t, dir)
+
+	Info("before shutdown")
+	name := sinks.flight.openFile()
+	if filepath.Dir(name) != dir {
+		t.Fatalf("flight recorder file %q, want one in %s", name, dir)
+	}
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if got := sinks.flight.openFile(); got != "" {
+		t.Errorf("flight recorder file %s still mapped after Shutdown", got)
+	}
+	Info("after shutdown")
+	if got := decodeFlightFile(t, name); !strings.HasSuffix(got, "] before shutdown\n") {
+		t.Errorf("DecodeFlightRecorder() wrote\n%s\nwant the entries logged before Shutdown", got)
+	}
+
+	*logDir = t.TempDir()
+	RestartFileSink()
+	Info("after restart")
+	if restarted := sinks.flight.openFile(); filepath.Dir(restarted) != *logDir {
+		t.Errorf("flight recorder file %q after RestartFileSink, want one in the new -log_dir=%s", restarted, *logDir)
+	}
+}
+
+func TestFlightRecorderRetention(t *testing.T) {
+	setFlags()
+	defer func(previous uint64) { *logFlightRecorderSize = previous }(*logFlightRecorderSize)
+	*logFlightRecorderSize = minFlightSize
+	dir := t.TempDir()
+	useLogDir(t, dir)
+
+	Info("x")
+	current := sinks.flight.openFile()
+	// Set after the files are created, so that cleanLogDir does not also run
+	// in the background.
+	setRetention(t, 1, 0, 0)
+	var old []string
+	for i := 3; i > 0; i-- {
+		modTime := time.Now().Add(-time.Duration(i) * time.Hour)
+		name := filepath.Join(dir, fmt.Sprintf("%s.%s.%s.flight.%s.%d",
+			program, host, userName, modTime.Format("20060102-150405"), pid+i))
+		if err := os.WriteFile(name, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		old = append(old, name)
+	}
+	// The file in use is kept, even though it is the oldest.
+	oldest := time.Now().Add(-4 * time.Hour)
+	if err := os.Chtimes(current, oldest, oldest); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanLogDir(dir)
+	for _, name := range old[:2] {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("os.Stat(%s) = %v after cleanup, want the old flight recorder file removed", name, err)
+		}
+	}
+	for _, name := range []string{old[2], current} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("os.Stat(%s) = %v after cleanup, want the newest and the current files kept", name, err)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package glog
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFlightFile maps the first size bytes of f into memory, shared with the
+// file so that the kernel writes changes back to it.
+func mapFlightFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+// unmapFlightFile unmaps a file mapped by mapFlightFile.
+func unmapFlightFile(b []byte) error {
+	return syscall.Munmap(b)
+}
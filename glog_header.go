@@ -0,0 +1,250 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Headers of log files.
+
+package glog
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// processStart approximates the time at which the process started: the time
+// at which this package was initialized.
+var processStart = time.Now()
+
+var logHeaderFormat = choiceFlag{choices: []string{"text", "json"}} // The -log_header_format flag.
+
+func init() {
+	flag.Var(&logHeaderFormat, glogFlag("log_header_format"), "format of log file headers: text or json (default json if -log_format=json, else text)")
+}
+
+// jsonHeader reports whether log file headers are written as JSON.
+func jsonHeader() bool {
+	switch logHeaderFormat.get() {
+	case "text":
+		return false
+	case "json":
+		return true
+	}
+	return jsonFiles()
+}
+
+// headerLine is an application-specific header line.
+type headerLine struct{ key, value string }
+
+var extraHeaders struct {
+	mu    sync.Mutex
+	lines []headerLine
+}
+
+// lineBreaks replaces the line breaks in header lines.
+var lineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+
+// AddFileHeader adds the line "key: value" to the header of the log files
+// created from now on, or replaces the value of an existing line with that
+// key.  Line breaks in key and value are replaced with spaces.  In JSON
+// headers, the lines appear as members of the "extra" object.
+func AddFileHeader(key, value string) {
+	key, value = lineBreaks.Replace(key), lineBreaks.Replace(value)
+	extraHeaders.mu.Lock()
+	defer extraHeaders.mu.Unlock()
+	for i, l := range extraHeaders.lines {
+		if l.key == key {
+			extraHeaders.lines[i].value = value
+			return
+		}
+	}
+	extraHeaders.lines = append(extraHeaders.lines, headerLine{key, value})
+}
+
+// buildInfo describes the main module of the program, as recorded by the Go
+// toolchain.
+type buildInfo struct {
+	Path     string `json:"module,omitempty"`
+	Version  string `json:"module_version,omitempty"`
+	Revision string `json:"vcs_revision,omitempty"`
+	Time     string `json:"vcs_time,omitempty"`
+	Modified bool   `json:"vcs_modified,omitempty"`
+}
+
+var (
+	buildInfoOnce sync.Once
+	buildInfoRead buildInfo // Set by buildInfoOnce.
+)
+
+// readBuildInfo returns the buildInfo of the program, read only once.
+func readBuildInfo() buildInfo {
+	buildInfoOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		b := &buildInfoRead
+		b.Path, b.Version = info.Main.Path, info.Main.Version
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Revision = s.Value
+			case "vcs.time":
+				b.Time = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+	})
+	return buildInfoRead
+}
+
+// String returns a description of b for text headers, or "" if nothing is
+// known about the build.
+func (b buildInfo) String() string {
+	if b.Path == "" {
+		return ""
+	}
+	s := b.Path + " " + b.Version
+	var vcs []string
+	if b.Revision != "" {
+		vcs = append(vcs, "revision "+b.Revision)
+	}
+	if b.Modified {
+		vcs = append(vcs, "modified")
+	}
+	if b.Time != "" {
+		vcs = append(vcs, b.Time)
+	}
+	if len(vcs) > 0 {
+		s += " (" + strings.Join(vcs, ", ") + ")"
+	}
+	return s
+}
+
+// commandLine returns the command line of the process, with the arguments
+// quoted where needed to tell them apart.
+func commandLine() string {
+	args := make([]string, len(os.Args))
+	for i, a := range os.Args {
+		if a == "" || strings.ContainsAny(a, " \t\n\"'\\") || !strconv.IsPrint(rune(a[0])) {
+			a = strconv.Quote(a)
+		}
+		args[i] = a
+	}
+	return strings.Join(args, " ")
+}
+
+// glogFlags holds the names of the flags defined by this package.
+var glogFlags = make(map[string]bool)
+
+// glogFlag records name as that of a flag defined by this package, and returns
+// it, so that each flag is recorded where it is registered.
+func glogFlag(name string) string {
+	glogFlags[name] = true
+	return name
+}
+
+// changedGlogFlags returns the values of the flags of this package that differ
+// from their defaults, as "-name=value", sorted by name.
+func changedGlogFlags() []string {
+	var flags []string
+	flag.VisitAll(func(f *flag.Flag) {
+		if glogFlags[f.Name] {
+			if v := f.Value.String(); v != f.DefValue {
+				flags = append(flags, "-"+f.Name+"="+v)
+			}
+		}
+	})
+	sort.Strings(flags)
+	return flags
+}
+
+// fileHeader returns the header written at the start of each log file created
+// at time now, whose predecessor in the chain of files is previous.
+//
+// The JSON header (see -log_header_format) is a single JSON object, so that
+// every line of a file of JSON entries is valid JSON.
+func fileHeader(now time.Time, previous string) []byte {
+	binary := fmt.Sprintf("Built with %s %s for %s/%s", runtime.Compiler, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	build := readBuildInfo()
+	flags := changedGlogFlags()
+	extraHeaders.mu.Lock()
+	extra := append([]headerLine(nil), extraHeaders.lines...)
+	extraHeaders.mu.Unlock()
+
+	if jsonHeader() {
+		extraMap := make(map[string]string, len(extra))
+		for _, l := range extra {
+			extraMap[l.key] = l.value
+		}
+		b, _ := json.Marshal(struct {
+			Created string `json:"log_file_created_at"`
+			Host    string `json:"running_on_machine"`
+			Binary  string `json:"binary"`
+			buildInfo
+			CommandLine []string          `json:"command_line"`
+			Flags       []string          `json:"flags"`
+			PID         int               `json:"pid"`
+			Started     string            `json:"process_started_at"`
+			Extra       map[string]string `json:"extra,omitempty"`
+			Previous    string            `json:"previous_log"`
+			Format      string            `json:"log_line_format"`
+		}{
+			Created:     now.Format(time.RFC3339Nano),
+			Host:        host,
+			Binary:      binary,
+			buildInfo:   build,
+			CommandLine: os.Args,
+			Flags:       flags,
+			PID:         pid,
+			Started:     processStart.Format(time.RFC3339Nano),
+			Extra:       extraMap,
+			Previous:    previous,
+			Format:      "json",
+		})
+		return append(b, '\n')
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Log file created at: %s\n", now.Format("2006/01/02 15:04:05"))
+	fmt.Fprintf(&buf, "Running on machine: %s\n", host)
+	fmt.Fprintf(&buf, "Binary: %s\n", binary)
+	if s := build.String(); s != "" {
+		fmt.Fprintf(&buf, "Build: %s\n", s)
+	}
+	fmt.Fprintf(&buf, "Command line: %s\n", commandLine())
+	fmt.Fprintf(&buf, "Log flags: %s\n", strings.Join(flags, " "))
+	fmt.Fprintf(&buf, "Process: pid %d, started at %s\n", pid, processStart.Format("2006/01/02 15:04:05"))
+	for _, l := range extra {
+		fmt.Fprintf(&buf, "%s: %s\n", l.key, l.value)
+	}
+	fmt.Fprintf(&buf, "Previous log: %s\n", previous)
+	if jsonFiles() {
+		fmt.Fprintf(&buf, "Log line format: json\n")
+	} else {
+		fmt.Fprintf(&buf, "Log line format: [IWEF]mmdd hh:mm:ss.uuuuuu threadid file:line] msg\n")
+	}
+	return buf.Bytes()
+}
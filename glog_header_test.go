@@ -0,0 +1,94 @@
+package glog
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileHeader(t *testing.T) {
+	defer func(previous []headerLine) { extraHeaders.lines = previous }(extraHeaders.lines)
+	AddFileHeader("Service", "old")
+	AddFileHeader("Service", "frontend\nlocal")
+	defer flag.Lookup("log_flush_interval").Value.Set(defaultFlushInterval.String())
+	if err := flag.Lookup("log_flush_interval").Value.Set("5s"); err != nil {
+		t.Fatal(err)
+	}
+
+	header := string(fileHeader(time.Now(), "prev.log"))
+	for _, want := range []string{
+		"Command line: " + commandLine() + "\n",
+		"Log flags: ",
+		" -log_flush_interval=5s",
+		fmt.Sprintf("Process: pid %d, started at ", os.Getpid()),
+		"Service: frontend local\nPrevious log: prev.log\n",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("fileHeader() = %q, want it to contain %q", header, want)
+		}
+	}
+	if !strings.HasPrefix(header, "Log file created at: ") || !strings.HasSuffix(header, "Log line format: [IWEF]mmdd hh:mm:ss.uuuuuu threadid file:line] msg\n") {
+		t.Errorf("fileHeader() = %q, want the creation time first and the line format last", header)
+	}
+
+	if err := flag.Lookup("log_header_format").Value.Set("json"); err != nil {
+		t.Fatal(err)
+	}
+	defer flag.Lookup("log_header_format").Value.Set("")
+	var h struct {
+		CommandLine []string          `json:"command_line"`
+		Flags       []string          `json:"flags"`
+		PID         int               `json:"pid"`
+		Extra       map[string]string `json:"extra"`
+		Previous    string            `json:"previous_log"`
+	}
+	b := fileHeader(time.Now(), "prev.log")
+	if err := json.Unmarshal(b, &h); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", b, err)
+	}
+	if len(h.CommandLine) != len(os.Args) || h.PID != os.Getpid() || h.Extra["Service"] != "frontend local" || h.Previous != "prev.log" ||
+		!strings.Contains(strings.Join(h.Flags, " "), "-log_header_format=json") {
+		t.Errorf("JSON file header = %s, want the command line, pid, flags, extra lines and previous log", b)
+	}
+}
+
+func TestChangedGlogFlagsOnly(t *testing.T) {
+	if flag.Lookup("login_token") == nil {
+		flag.String("login_token", "", "an application flag that glog must not log")
+	}
+	if err := flag.Set("login_token", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer flag.Set("login_token", "")
+
+	for _, f := range changedGlogFlags() {
+		if strings.HasPrefix(f, "-login_token=") {
+			t.Errorf("changedGlogFlags() = %q, want it not to contain flags defined elsewhere", changedGlogFlags())
+		}
+	}
+}
+
+func TestChangedGlogFlagsIncludesAll(t *testing.T) {
+	for _, f := range []struct{ name, value string }{
+		{"log_multiline", "prefix"},
+		{"log_escape_control_chars", "true"},
+	} {
+		if err := flag.Set(f.name, f.value); err != nil {
+			t.Fatal(err)
+		}
+		defer flag.Set(f.name, flag.Lookup(f.name).DefValue)
+
+		want := "-" + f.name + "=" + f.value
+		found := false
+		for _, got := range changedGlogFlags() {
+			found = found || got == want
+		}
+		if !found {
+			t.Errorf("changedGlogFlags() = %q, want it to contain %q", changedGlogFlags(), want)
+		}
+	}
+}
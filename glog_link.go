@@ -0,0 +1,121 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Symlinks to the latest log files.
+
+package glog
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+)
+
+var (
+	logLatestLink  = flag.Bool(glogFlag("log_latest_link"), false, "If true, also maintain a symlink named program.log to the latest log file of any severity")
+	logLinkTargets = choiceFlag{choices: []string{"relative", "absolute"}} // The -log_link_targets flag.
+)
+
+func init() {
+	flag.Var(&logLinkTargets, glogFlag("log_link_targets"), "how symlinks refer to log files: relative (to the symlink) or absolute (default relative in the log directory, and as named in -log_dir in -log_link)")
+}
+
+// latestLinkName returns the name of the symlink maintained by
+// -log_latest_link.
+func latestLinkName() string {
+	return program + ".log"
+}
+
+// linkTarget returns the target of a symlink in linkDir to the log file
+// fname, as selected by -log_link_targets.  inLogDir tells whether linkDir is
+// the directory of the log file, rather than -log_link.
+func linkTarget(linkDir, fname string, inLogDir bool) (string, error) {
+	switch logLinkTargets.get() {
+	case "absolute":
+		return filepath.Abs(fname)
+	case "relative":
+		absDir, err := filepath.Abs(linkDir)
+		if err != nil {
+			return "", err
+		}
+		absName, err := filepath.Abs(fname)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Rel(absDir, absName)
+	}
+	if inLogDir {
+		return filepath.Rel(linkDir, fname)
+	}
+	return fname, nil
+}
+
+// updateLinks points the symlinks named link (and, with -log_latest_link,
+// latestLinkName()) in the log directory dir and in -log_link to the newly
+// created log file fname.  The first failure is logged as a WARNING.
+func updateLinks(dir, link, fname string) {
+	linkDirs := []string{dir}
+	if *logLink != "" {
+		linkDirs = append(linkDirs, *logLink)
+	}
+	links := []string{link}
+	if *logLatestLink {
+		links = append(links, latestLinkName())
+	}
+	for i, linkDir := range linkDirs {
+		target, err := linkTarget(linkDir, fname, i == 0)
+		for _, l := range links {
+			if err == nil {
+				err = replaceSymlink(target, filepath.Join(linkDir, l))
+			}
+			if err != nil {
+				warnSymlinkError(err)
+			}
+		}
+	}
+}
+
+// replaceSymlink atomically replaces link, if it exists, with a symlink to
+// target, so that readers of link always find a log file: the new symlink is
+// created under a temporary name and then renamed.
+func replaceSymlink(target, link string) error {
+	tmp := link + "." + strconv.Itoa(pid) + ".tmp"
+	os.Remove(tmp) // ignore err: left over from a crash, or absent
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	setLinkGroup(tmp) // ignore err
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// symlinkWarned is set once a symlink error has been logged.
+var symlinkWarned atomic.Bool
+
+// warnSymlinkError logs err as a WARNING, unless a symlink error has already
+// been logged.  It is called with fileSink.mu held, so the message is logged by
+// another goroutine.
+func warnSymlinkError(err error) {
+	if symlinkWarned.Swap(true) {
+		return
+	}
+	go Warningf("log: cannot update symlink to log file (further symlink errors are not logged): %v", err)
+}
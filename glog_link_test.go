@@ -0,0 +1,75 @@
+package glog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateLinks(t *testing.T) {
+	defer func(previous string) { *logLink = previous }(*logLink)
+	defer func(previous bool) { *logLatestLink = previous }(*logLatestLink)
+	defer logLinkTargets.Set("")
+	dir, linkDir := t.TempDir(), t.TempDir()
+	*logLink = linkDir
+	*logLatestLink = true
+
+	for _, tc := range []struct {
+		targets           string
+		wantDir, wantLink func(fname string) string
+	}{
+		{
+			targets:  "",
+			wantDir:  func(fname string) string { return filepath.Base(fname) },
+			wantLink: func(fname string) string { return fname },
+		},
+		{
+			targets:  "absolute",
+			wantDir:  func(fname string) string { return fname },
+			wantLink: func(fname string) string { return fname },
+		},
+		{
+			targets: "relative",
+			wantDir: func(fname string) string { return filepath.Base(fname) },
+			wantLink: func(fname string) string {
+				rel, _ := filepath.Rel(linkDir, fname)
+				return rel
+			},
+		},
+	} {
+		if err := logLinkTargets.Set(tc.targets); err != nil {
+			t.Fatal(err)
+		}
+		f, fname, err := create("WARNING", time.Now(), dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		for _, l := range []struct{ path, want string }{
+			{filepath.Join(dir, program+".WARNING"), tc.wantDir(fname)},
+			{filepath.Join(dir, program+".log"), tc.wantDir(fname)},
+			{filepath.Join(linkDir, program+".WARNING"), tc.wantLink(fname)},
+			{filepath.Join(linkDir, program+".log"), tc.wantLink(fname)},
+		} {
+			if got, err := os.Readlink(l.path); err != nil || got != l.want {
+				t.Errorf("-log_link_targets=%q: os.Readlink(%s) = %q, %v, want %q", tc.targets, l.path, got, err, l.want)
+			}
+		}
+		os.Remove(fname) // So that the next file may have the same name.
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("temporary symlink %s left in the log directory", e.Name())
+		}
+	}
+	if err := logLinkTargets.Set("sideways"); err == nil {
+		t.Error("-log_link_targets=sideways accepted, want error")
+	}
+}
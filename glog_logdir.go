@@ -0,0 +1,150 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Health checks of log directories.
+
+package glog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// dirWritable returns an error if a file cannot be created in dir.
+func dirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".glog-probe-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkLogDirs moves the log files in a directory that is no longer writable
+// to the first writable directory in logDirs, recording the switch in both
+// files.  The directories are probed without s.mu, since creating a file on a
+// failing disk may block for a long time.  The errors met are logged once s.mu
+// has been released.
+func (s *fileSink) checkLogDirs() {
+	s.mu.Lock()
+	dirs := append([]string(nil), logDirs...)
+	var inUse []string
+	if len(dirs) >= 2 {
+		for _, sb := range s.syncBuffers() {
+			if sb.file != nil && sb.path == "" {
+				inUse = append(inUse, logRoot(sb.file.Name()))
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	checked := make(map[string]error)
+	probe := func(dir string) error {
+		err, ok := checked[dir]
+		if !ok {
+			err = dirWritable(dir)
+			checked[dir] = err
+		}
+		return err
+	}
+	failing := false
+	for _, dir := range inUse {
+		if probe(dir) != nil {
+			failing = true
+		}
+	}
+	if !failing {
+		return
+	}
+	to := ""
+	for _, dir := range dirs {
+		if probe(dir) == nil {
+			to = dir
+			break
+		}
+	}
+
+	var errs []error
+	func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !equalStrings(logDirs, dirs) {
+			return // RestartFileSink chose new directories while probing.
+		}
+		for _, sb := range s.syncBuffers() {
+			if sb.file == nil || sb.path != "" {
+				continue
+			}
+			from := logRoot(sb.file.Name())
+			if reason := checked[from]; reason != nil {
+				if err := sb.switchLogDir(from, reason, to); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}()
+	for _, err := range errs {
+		reportSinkError("log: switching log directory: %v", err)
+	}
+}
+
+// equalStrings reports whether a and b hold the same strings in the same
+// order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// switchLogDir rotates sb away from the directory from, which is not writable
+// because of reason, into the directory to.  If to is empty, as no directory
+// is writable, sb is left as it is.
+// s.mu is held.
+func (sb *syncBuffer) switchLogDir(from string, reason error, to string) error {
+	if to == "" {
+		return fmt.Errorf("no writable log directory (%s: %v)", from, reason)
+	}
+
+	marker := dirSwitchMarker(from, to, reason)
+	sb.Writer.Write(marker) // The old file may no longer be writable either.
+	if err := sb.rotateFile(timeNow()); err != nil {
+		return err
+	}
+	n, err := sb.Writer.Write(marker)
+	sb.nbytes += uint64(n)
+	return err
+}
+
+// dirSwitchMarker returns the line recording that logging moved from the
+// directory from to the directory to because of err.
+func dirSwitchMarker(from, to string, err error) []byte {
+	if jsonFiles() {
+		b, _ := json.Marshal(struct {
+			From  string `json:"log_dir_switched_from"`
+			To    string `json:"log_dir_switched_to"`
+			Error string `json:"log_dir_error"`
+		}{from, to, err.Error()})
+		return append(b, '\n')
+	}
+	return []byte(fmt.Sprintf("Log directory %s is not writable (%v); continuing in %s\n", from, err, to))
+}
@@ -0,0 +1,90 @@
+package glog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useLogDir sets -log_dir to dir with new log files for the duration of a
+// test, keeping the log files of other tests open.
+func useLogDir(t *testing.T, dir string) {
+	t.Helper()
+	previous := *logDir
+	old := sinks.file.swap(severityWriters{})
+	t.Cleanup(func() {
+		*logDir = previous
+		RestartFileSink()
+		sinks.file.swap(old)
+	})
+	*logDir = dir
+	RestartFileSink()
+}
+
+func TestLogDirCandidates(t *testing.T) {
+	setFlags()
+	defer func(previous bool) { *logDirCreate = previous }(*logDirCreate)
+	*logDirCreate = true
+	missing := filepath.Join(t.TempDir(), "a", "b")
+	fallback := t.TempDir()
+	useLogDir(t, missing+string(os.PathListSeparator)+fallback)
+
+	Info("created")
+	names, err := Names("INFO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(names[0]) != missing {
+		t.Errorf("Names(INFO) = %v, want a file in %s", names, missing)
+	}
+}
+
+func TestLogDirSwitch(t *testing.T) {
+	setFlags()
+	first, second := t.TempDir(), t.TempDir()
+	useLogDir(t, first+string(os.PathListSeparator)+second)
+
+	Info("in first")
+	names, err := Names("INFO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make the first directory unusable, even for root.
+	moved := first + ".moved"
+	if err := os.Rename(first, moved); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(moved)
+	if err := os.WriteFile(first, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(first)
+
+	sinks.file.checkLogDirs()
+	Info("in second")
+	sinks.file.Flush()
+
+	names, err = Names("INFO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || filepath.Dir(names[1]) != second {
+		t.Fatalf("Names(INFO) = %v, want a second file in %s", names, second)
+	}
+	marker := "Log directory " + first + " is not writable"
+	old, err := os.ReadFile(filepath.Join(moved, filepath.Base(names[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(old), "] in first\n"+marker) || !strings.Contains(string(old), "Next log: "+names[1]) {
+		t.Errorf("old file has contents:\n%s\nwant a line starting with %q and a footer naming %s", old, marker, names[1])
+	}
+	b, err := os.ReadFile(names[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), marker) || !strings.HasSuffix(string(b), "] in second\n") {
+		t.Errorf("new file has contents:\n%s\nwant a line starting with %q and the new entry", b, marker)
+	}
+}
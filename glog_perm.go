@@ -0,0 +1,194 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Permissions and ownership of log files.
+
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+// fileModeFlag is an atomic flag.Value implementation for the -log_file_mode
+// flag.  It holds the permission bits with modeSet added, or zero if the flag
+// is not set.
+type fileModeFlag uint32
+
+const modeSet = 1 << 31
+
+// get returns the permission bits for new log files, and whether they were set
+// by the flag.
+func (f *fileModeFlag) get() (os.FileMode, bool) {
+	v := atomic.LoadUint32((*uint32)(f))
+	if v == 0 {
+		return 0666, false
+	}
+	return os.FileMode(v &^ modeSet), true
+}
+
+func (f *fileModeFlag) String() string {
+	if mode, ok := f.get(); ok {
+		return fmt.Sprintf("%#o", uint32(mode))
+	}
+	return ""
+}
+
+func (f *fileModeFlag) Get() any {
+	mode, _ := f.get()
+	return mode
+}
+
+func (f *fileModeFlag) Set(value string) error {
+	if value == "" {
+		atomic.StoreUint32((*uint32)(f), 0)
+		return nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("invalid log file mode %q (want octal permission bits such as 0640)", value)
+	}
+	atomic.StoreUint32((*uint32)(f), uint32(mode)|modeSet)
+	return nil
+}
+
+// groupFlag is a flag.Value implementation for the -log_file_group flag.
+type groupFlag struct {
+	g atomic.Pointer[logGroup]
+}
+
+type logGroup struct {
+	name string
+	gid  int
+}
+
+// get returns the id of the group for new log files, and whether one is set.
+func (f *groupFlag) get() (int, bool) {
+	if g := f.g.Load(); g != nil {
+		return g.gid, true
+	}
+	return 0, false
+}
+
+func (f *groupFlag) String() string {
+	if g := f.g.Load(); g != nil {
+		return g.name
+	}
+	return ""
+}
+
+func (f *groupFlag) Get() any { return f.String() }
+
+func (f *groupFlag) Set(value string) error {
+	if value == "" {
+		f.g.Store(nil)
+		return nil
+	}
+	gid, err := lookupGroup(value)
+	if err != nil {
+		return fmt.Errorf("invalid log file group %q: %v", value, err)
+	}
+	f.g.Store(&logGroup{name: value, gid: gid})
+	return nil
+}
+
+var (
+	logFileMode  fileModeFlag // The -log_file_mode flag.
+	logFileGroup groupFlag    // The -log_file_group flag.
+)
+
+func init() {
+	flag.Var(&logFileMode, glogFlag("log_file_mode"), "If non-empty, the octal permission bits, such as 0640, of new log files, regardless of the umask; new log directories also get search permission where they are readable")
+	flag.Var(&logFileGroup, glogFlag("log_file_group"), "If non-empty, the name or id of the group owning new log files and directories")
+}
+
+// newFileMode returns the mode with which to create log files.
+func newFileMode() os.FileMode {
+	mode, _ := logFileMode.get()
+	return mode
+}
+
+// dirMode returns the mode of log directories holding files with the given
+// mode: search permission is added wherever read permission is granted.
+func dirMode(mode os.FileMode) os.FileMode {
+	return mode | (mode&0444)>>2
+}
+
+// setFilePerms applies -log_file_mode and -log_file_group to the newly
+// created log file f.  The mode is set again in case the umask cleared some of
+// its bits.
+func setFilePerms(f *os.File) error {
+	if mode, ok := logFileMode.get(); ok {
+		if err := f.Chmod(mode); err != nil {
+			return err
+		}
+	}
+	if gid, ok := logFileGroup.get(); ok {
+		if err := f.Chown(-1, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setLinkGroup applies -log_file_group to the newly created symlink name.
+func setLinkGroup(name string) error {
+	if gid, ok := logFileGroup.get(); ok {
+		return os.Lchown(name, -1, gid)
+	}
+	return nil
+}
+
+// mkdirAll is like os.MkdirAll, but applies -log_file_mode (as adjusted by
+// dirMode) and -log_file_group to the directories it creates.
+func mkdirAll(path string) error {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+	}
+	if parent := filepath.Dir(path); parent != path {
+		if err := mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	mode, modeSet := logFileMode.get()
+	perm := os.FileMode(0777)
+	if modeSet {
+		perm = dirMode(mode)
+	}
+	if err := os.Mkdir(path, perm); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	if modeSet {
+		if err := os.Chmod(path, perm); err != nil {
+			return err
+		}
+	}
+	if gid, ok := logFileGroup.get(); ok {
+		return os.Chown(path, -1, gid)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Reopening of log files rotated by external tools such as logrotate.
+
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+var logDetectRotation = flag.Bool(glogFlag("log_detect_rotation"), false, "If true, periodically check whether log files have been moved, deleted or truncated by another program, such as logrotate, and reopen them if so")
+
+// Reopen flushes and closes the current log files and opens them again by
+// name, creating them if they no longer exist.  It is meant to be called once
+// an external tool such as logrotate has renamed the files.
+//
+// If a file cannot be reopened, logging continues to the file already open,
+// and Reopen returns the first error.
+func Reopen() error {
+	return sinks.file.reopen(func(*syncBuffer) bool { return true })
+}
+
+var reopenSignals struct {
+	once sync.Once
+	c    chan os.Signal
+}
+
+// ReopenOnSignal arranges for the log files to be reopened, as by Reopen,
+// whenever the process receives one of sigs, such as syscall.SIGHUP.  Errors
+// are logged.
+func ReopenOnSignal(sigs ...os.Signal) {
+	reopenSignals.once.Do(func() {
+		reopenSignals.c = make(chan os.Signal, 1)
+		go func() {
+			for range reopenSignals.c {
+				if err := Reopen(); err != nil {
+					reportSinkError("log: reopening log files: %v", err)
+				}
+			}
+		}()
+	})
+	signal.Notify(reopenSignals.c, sigs...)
+}
+
+// reopenRotated reopens the log files that have been moved, deleted or
+// truncated since they were opened, as detected by -log_detect_rotation.
+func (s *fileSink) reopenRotated() {
+	if err := s.reopen((*syncBuffer).rotatedExternally); err != nil {
+		reportSinkError("log: reopening rotated log files: %v", err)
+	}
+}
+
+// reopen reopens the log files for which need returns true.
+func (s *fileSink) reopen(need func(*syncBuffer) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for _, sb := range s.syncBuffers() {
+		if sb.file == nil || !need(sb) {
+			continue
+		}
+		if err := sb.reopen(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// rotatedExternally reports whether the file of sb no longer has its name, or
+// is smaller than what has been written to it.
+// s.mu is held.
+func (sb *syncBuffer) rotatedExternally() bool {
+	fi, err := sb.file.Stat()
+	if err != nil {
+		return false
+	}
+	pfi, err := os.Stat(sb.file.Name())
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	written := sb.nbytes - uint64(sb.Buffered())
+	return !os.SameFile(fi, pfi) || uint64(fi.Size()) < written
+}
+
+// reopen replaces the file of sb with a new one opened by the same name, in
+// append mode.  A header is written if the file is empty.
+// s.mu is held.
+func (sb *syncBuffer) reopen() error {
+	name := sb.file.Name()
+	// Unlike the files created by createInDir, the reopened file may already
+	// exist, so do not follow a symlink planted there by someone else.  The
+	// -log_file path is opened following symlinks in the first place, so it
+	// is reopened the same way.
+	flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+	if sb.path == "" {
+		flags |= oNoFollow
+	}
+	f, err := os.OpenFile(name, flags, newFileMode())
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err == nil && !fi.Mode().IsRegular() {
+		err = fmt.Errorf("log: not reopening %s: not a regular file", name)
+	}
+	if err == nil && fi.Size() == 0 {
+		err = setFilePerms(f)
+		// The header goes first even when f is the file already open, as
+		// truncated in place by logrotate's copytruncate, since the entries
+		// still buffered are appended to it below.
+		if err == nil {
+			_, err = f.Write(fileHeader(timeNow(), "<none>"))
+		}
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	sb.Flush()
+	sb.file.Close()
+	sb.file = f
+	sb.Writer.Reset(f)
+	if fi, err = f.Stat(); err != nil {
+		return err
+	}
+	sb.nbytes = uint64(fi.Size())
+	return nil
+}
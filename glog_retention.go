@@ -0,0 +1,238 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Retention of old log files.
+
+package glog
+
+import (
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+var (
+	logMaxFiles = flag.Int(glogFlag("log_max_files"), 0, "If positive, delete the oldest log files of this program beyond this number per severity in each log directory")
+	logMaxAge   = flag.Duration(glogFlag("log_max_age"), 0, "If positive, delete log files of this program older than this")
+	logMaxTotal = flag.Uint64(glogFlag("log_max_total_size"), 0, "If positive, delete the oldest log files of this program while their total size in a log directory exceeds this many bytes")
+)
+
+// retentionEnabled reports whether any of the retention flags is set.
+func retentionEnabled() bool {
+	return *logMaxFiles > 0 || *logMaxAge > 0 || *logMaxTotal > 0
+}
+
+// cleaner deletes old log files in the background.
+var cleaner struct {
+	once    sync.Once
+	wake    chan struct{}
+	mu      sync.Mutex
+	pending map[string]bool // Directories to clean.
+}
+
+// scheduleCleanup arranges for the retention flags to be applied to dir in the
+// background.  It does not block.
+func scheduleCleanup(dir string) {
+	if !retentionEnabled() {
+		return
+	}
+	cleaner.once.Do(func() {
+		cleaner.wake = make(chan struct{}, 1)
+		cleaner.pending = make(map[string]bool)
+		go cleanupDaemon()
+	})
+	cleaner.mu.Lock()
+	cleaner.pending[dir] = true
+	cleaner.mu.Unlock()
+	select {
+	case cleaner.wake <- struct{}{}:
+	default:
+	}
+}
+
+// cleanupDaemon cleans the directories passed to scheduleCleanup.
+func cleanupDaemon() {
+	for range cleaner.wake {
+		cleaner.mu.Lock()
+		dirs := cleaner.pending
+		cleaner.pending = make(map[string]bool)
+		cleaner.mu.Unlock()
+		for dir := range dirs {
+			cleanLogDir(dir)
+		}
+	}
+}
+
+// logFileInfo describes a log file considered for deletion.
+type logFileInfo struct {
+	path    string
+	tag     string
+	size    int64
+	modTime time.Time
+}
+
+// cleanLogDir deletes the log files of this program in dir that the retention
+// flags no longer allow, except for those currently open and the targets of
+// the symlinks to them.  Log files are those named by -log_file_template,
+// possibly in its subdirectories of dir, the numbered siblings of the
+// -log_file file if it is in dir, and the -log_flight_recorder_size files.
+func cleanLogDir(dir string) {
+	tmpl := fileTemplate.get()
+	match := tmpl.matcher()
+	tagIndex := match.SubexpIndex("tag")
+	single := ""
+	if *logFile != "" && filepath.Clean(filepath.Dir(*logFile)) == filepath.Clean(dir) {
+		single = filepath.Base(*logFile)
+	}
+	protected := protectedLogFiles(dir)
+
+	var files []logFileInfo
+	filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if e.IsDir() {
+			if strings.Count(rel, "/") >= tmpl.depth {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !e.Type().IsRegular() {
+			return nil
+		}
+		var tag string
+		if single != "" && strings.HasPrefix(rel, single) && numberedNameRE.MatchString(rel[len(single):]) {
+			// The files rotated from -log_file share its empty tag.
+		} else if isFlightFile(rel) {
+			tag = "flight" // Counted apart from the files of each severity.
+		} else if sm := match.FindStringSubmatch(rel); sm != nil {
+			tag = sm[tagIndex]
+		} else {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, logFileInfo{
+			path:    path,
+			tag:     tag,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	// Newest first by modification time, then by descending path, which puts
+	// the later of two files with the same time first when names embed it.
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.After(files[j].modTime)
+		}
+		return files[i].path > files[j].path
+	})
+
+	cutoff := time.Time{}
+	if *logMaxAge > 0 {
+		cutoff = timeNow().Add(-*logMaxAge)
+	}
+	perTag := make(map[string]int)
+	var total uint64
+	for _, f := range files {
+		perTag[f.tag]++
+		total += uint64(f.size)
+		if protected[f.path] {
+			continue
+		}
+		expired := !cutoff.IsZero() && f.modTime.Before(cutoff)
+		tooMany := *logMaxFiles > 0 && perTag[f.tag] > *logMaxFiles
+		tooBig := *logMaxTotal > 0 && total > *logMaxTotal
+		if expired || tooMany || tooBig {
+			if os.Remove(f.path) == nil {
+				perTag[f.tag]--
+				total -= uint64(f.size)
+				removeEmptyDirs(filepath.Dir(f.path), dir)
+			}
+		}
+	}
+}
+
+// removeEmptyDirs removes dir and its parents up to but excluding root, for as
+// long as they are empty, as happens once all the log files in a subdirectory
+// named by -log_file_template have been deleted.
+func removeEmptyDirs(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// protectedLogFiles returns the paths of the log files in dir that must not be
+// deleted: those currently open or mapped, and the targets of the symlinks to the latest
+// log files in dir and in -log_link.
+func protectedLogFiles(dir string) map[string]bool {
+	protected := make(map[string]bool)
+	sinks.file.mu.Lock()
+	for _, w := range sinks.file.file {
+		if sb, ok := w.(*syncBuffer); ok && sb.file != nil {
+			protected[filepath.Clean(sb.file.Name())] = true
+		}
+	}
+	if sb := sinks.file.single; sb != nil && sb.file != nil {
+		protected[filepath.Clean(sb.file.Name())] = true
+	}
+	sinks.file.mu.Unlock()
+	if name := sinks.flight.openFile(); name != "" {
+		protected[filepath.Clean(name)] = true
+	}
+
+	linkDirs := []string{dir}
+	if *logLink != "" {
+		linkDirs = append(linkDirs, *logLink)
+	}
+	links := []string{latestLinkName()}
+	for _, sev := range []logsink.Severity{logsink.Info, logsink.Warning, logsink.Error, logsink.Fatal} {
+		_, name := logName(sev.String(), time.Time{}, 0)
+		links = append(links, name)
+	}
+	for _, linkDir := range linkDirs {
+		for _, name := range links {
+			link := filepath.Join(linkDir, name)
+			target, err := os.Readlink(link)
+			if err != nil {
+				continue
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(linkDir, target)
+			}
+			protected[filepath.Clean(target)] = true
+		}
+	}
+	return protected
+}
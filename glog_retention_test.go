@@ -0,0 +1,105 @@
+package glog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// setRetention sets the retention flags for the duration of a test.
+func setRetention(t *testing.T, maxFiles int, maxAge time.Duration, maxTotal uint64) {
+	t.Helper()
+	oldFiles, oldAge, oldTotal := *logMaxFiles, *logMaxAge, *logMaxTotal
+	*logMaxFiles, *logMaxAge, *logMaxTotal = maxFiles, maxAge, maxTotal
+	t.Cleanup(func() { *logMaxFiles, *logMaxAge, *logMaxTotal = oldFiles, oldAge, oldTotal })
+}
+
+// makeLogFiles creates n log files of 100 bytes with the given tag in dir, one
+// hour apart and ending an hour ago, and returns their names, oldest first.
+func makeLogFiles(t *testing.T, dir, tag string, n int) []string {
+	t.Helper()
+	var names []string
+	for i := 0; i < n; i++ {
+		modTime := time.Now().Add(-time.Duration(n-i) * time.Hour)
+		name, _ := logName(tag, modTime, 0)
+		name = fmt.Sprintf("%s%d", name, i) // Distinct even within a second.
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, 100), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// remaining returns the sorted names of the files in dir.
+func remaining(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCleanLogDirMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	setRetention(t, 2, 0, 0)
+	infos := makeLogFiles(t, dir, "INFO", 4)
+	errs := makeLogFiles(t, dir, "ERROR", 1)
+	other := filepath.Join(dir, "other.log")
+	if err := os.WriteFile(other, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanLogDir(dir)
+	want := []string{errs[0], infos[2], infos[3], "other.log"}
+	sort.Strings(want)
+	if got := remaining(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("after cleanLogDir with -log_max_files=2, files = %v, want %v", got, want)
+	}
+}
+
+func TestCleanLogDirMaxAgeKeepsLinkTarget(t *testing.T) {
+	dir := t.TempDir()
+	setRetention(t, 0, 150*time.Minute, 0)
+	infos := makeLogFiles(t, dir, "INFO", 4)
+	// The oldest file is the target of the INFO symlink, so it must be kept.
+	link := program + ".INFO"
+	if err := os.Symlink(infos[0], filepath.Join(dir, link)); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	cleanLogDir(dir)
+	want := []string{infos[0], infos[2], infos[3], link}
+	sort.Strings(want)
+	if got := remaining(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("after cleanLogDir with -log_max_age=150m, files = %v, want %v", got, want)
+	}
+}
+
+func TestCleanLogDirMaxTotal(t *testing.T) {
+	dir := t.TempDir()
+	setRetention(t, 0, 0, 250)
+	infos := makeLogFiles(t, dir, "INFO", 2)
+	warnings := makeLogFiles(t, dir, "WARNING", 2)
+
+	cleanLogDir(dir)
+	// The newest file of each severity is an hour old.
+	want := []string{infos[1], warnings[1]}
+	sort.Strings(want)
+	if got := remaining(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("after cleanLogDir with -log_max_total_size=250, files = %v, want %v", got, want)
+	}
+}
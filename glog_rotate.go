@@ -0,0 +1,135 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Time-based rotation of log files.
+
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// minRotateInterval is the shortest interval accepted by -log_rotate_interval.
+// Log file names have a resolution of one second, so shorter intervals could
+// produce conflicting names.
+const minRotateInterval = time.Minute
+
+// rotateIntervalFlag is an atomic flag.Value implementation for the
+// -log_rotate_interval flag.  It holds the interval, or 0 if log files are not
+// rotated by time.
+type rotateIntervalFlag int64
+
+func (f *rotateIntervalFlag) get() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(f)))
+}
+
+func (f *rotateIntervalFlag) String() string {
+	switch d := f.get(); d {
+	case 0:
+		return ""
+	case time.Hour:
+		return "hourly"
+	case 24 * time.Hour:
+		return "daily"
+	default:
+		return d.String()
+	}
+}
+
+func (f *rotateIntervalFlag) Get() any { return f.get() }
+
+func (f *rotateIntervalFlag) Set(value string) error {
+	var d time.Duration
+	switch strings.ToLower(value) {
+	case "", "none":
+	case "hourly":
+		d = time.Hour
+	case "daily":
+		d = 24 * time.Hour
+	default:
+		var err error
+		if d, err = time.ParseDuration(value); err != nil {
+			return err
+		}
+		if d < minRotateInterval || d > 24*time.Hour {
+			return fmt.Errorf("log rotation interval %v out of range (min %v, max 24h)", d, minRotateInterval)
+		}
+	}
+	atomic.StoreInt64((*int64)(f), int64(d))
+	return nil
+}
+
+// locationFlag is a flag.Value implementation holding a *time.Location.
+type locationFlag struct {
+	loc atomic.Pointer[time.Location]
+}
+
+// get returns the location, time.Local if none has been set.
+func (f *locationFlag) get() *time.Location {
+	if loc := f.loc.Load(); loc != nil {
+		return loc
+	}
+	return time.Local
+}
+
+func (f *locationFlag) String() string { return f.get().String() }
+func (f *locationFlag) Get() any       { return f.get() }
+
+func (f *locationFlag) Set(value string) error {
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		return err
+	}
+	f.loc.Store(loc)
+	return nil
+}
+
+var (
+	rotateInterval rotateIntervalFlag // The -log_rotate_interval flag.
+	rotateLocation locationFlag       // The -log_rotate_timezone flag.
+)
+
+func init() {
+	flag.Var(&rotateInterval, glogFlag("log_rotate_interval"), "If non-empty, also start a new log file at every multiple of this interval since midnight: hourly, daily, or a duration between 1m and 24h")
+	flag.Var(&rotateLocation, glogFlag("log_rotate_timezone"), "time zone whose midnight -log_rotate_interval is aligned to, such as UTC (default Local)")
+}
+
+// nextRotation returns the first multiple of interval after t, counted from
+// midnight in loc.  The multiples restart at every midnight, so intervals that
+// do not divide a day evenly end early on the last rotation of the day.
+func nextRotation(t time.Time, interval time.Duration, loc *time.Location) time.Time {
+	lt := t.In(loc)
+	y, m, d := lt.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	nextMidnight := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	if interval >= 24*time.Hour {
+		return nextMidnight
+	}
+	if interval == time.Hour {
+		// Align to the wall clock even on days with a daylight saving time
+		// transition.
+		return time.Date(y, m, d, lt.Hour()+1, 0, 0, 0, loc)
+	}
+	next := midnight.Add((lt.Sub(midnight)/interval + 1) * interval)
+	if next.After(nextMidnight) {
+		return nextMidnight
+	}
+	return next
+}
@@ -0,0 +1,162 @@
+package glog
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+func TestNextRotation(t *testing.T) {
+	nyc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	for _, test := range []struct {
+		t        time.Time
+		interval time.Duration
+		loc      *time.Location
+		want     time.Time
+	}{
+		{
+			t:        time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC),
+			interval: time.Hour,
+			loc:      time.UTC,
+			want:     time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			t:        time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC),
+			interval: 24 * time.Hour,
+			loc:      time.UTC,
+			want:     time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			t:        time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC),
+			interval: 15 * time.Minute,
+			loc:      time.UTC,
+			want:     time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			// 7h does not divide a day: the last interval ends at midnight.
+			t:        time.Date(2024, 3, 1, 22, 0, 0, 0, time.UTC),
+			interval: 7 * time.Hour,
+			loc:      time.UTC,
+			want:     time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// Daily rotation is aligned to midnight in loc.
+			t:        time.Date(2024, 3, 1, 3, 0, 0, 0, time.UTC),
+			interval: 24 * time.Hour,
+			loc:      nyc,
+			want:     time.Date(2024, 3, 1, 0, 0, 0, 0, nyc),
+		},
+		{
+			// The day of the switch to daylight saving time is 23 hours long.
+			t:        time.Date(2024, 3, 10, 12, 0, 0, 0, nyc),
+			interval: 24 * time.Hour,
+			loc:      nyc,
+			want:     time.Date(2024, 3, 11, 0, 0, 0, 0, nyc),
+		},
+	} {
+		if got := nextRotation(test.t, test.interval, test.loc); !got.Equal(test.want) {
+			t.Errorf("nextRotation(%v, %v, %v) = %v, want %v", test.t, test.interval, test.loc, got, test.want)
+		}
+	}
+}
+
+func TestRotateIntervalFlag(t *testing.T) {
+	f := flag.Lookup("log_rotate_interval").Value
+	defer f.Set("")
+	for _, test := range []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "hourly", want: "hourly"},
+		{value: "DAILY", want: "daily"},
+		{value: "30m", want: "30m0s"},
+		{value: "", want: ""},
+		{value: "1s", wantErr: true},
+		{value: "48h", wantErr: true},
+		{value: "weekly", wantErr: true},
+	} {
+		err := f.Set(test.value)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("Set(%q) = %v, want error? %t", test.value, err, test.wantErr)
+			continue
+		}
+		if err == nil && f.String() != test.want {
+			t.Errorf("after Set(%q), String() = %q, want %q", test.value, f.String(), test.want)
+		}
+	}
+}
+
+func TestTimeRotation(t *testing.T) {
+	setFlags()
+	useLogDir(t, t.TempDir())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	fakeNow := time.Date(2024, 12, 23, 9, 59, 58, 0, time.Local)
+	timeNow = func() time.Time { return fakeNow }
+
+	if err := flag.Lookup("log_rotate_interval").Value.Set("hourly"); err != nil {
+		t.Fatal(err)
+	}
+	defer flag.Lookup("log_rotate_interval").Value.Set("")
+
+	Warning("before") // Be sure we have a file.
+	sinks.file.mu.Lock()
+	warning, ok := sinks.file.file[logsink.Warning].(*syncBuffer)
+	var err error
+	if ok {
+		// Start a file in this hour, with a name distinct from that of the
+		// file created by the call above.
+		err = warning.rotateFile(fakeNow.Add(-time.Second))
+	}
+	sinks.file.mu.Unlock()
+	if !ok {
+		t.Fatal("warning wasn't created")
+	}
+	if err != nil {
+		t.Fatalf("rotateFile: %v", err)
+	}
+	fileName := func() string {
+		sinks.file.mu.Lock()
+		defer sinks.file.mu.Unlock()
+		return warning.file.Name()
+	}
+
+	fname0 := fileName()
+	Warning("same hour")
+	if got := fileName(); got != fname0 {
+		t.Errorf("rotated to %s within the hour", got)
+	}
+
+	fakeNow = fakeNow.Add(3 * time.Second)
+	Warning("next hour")
+	sinks.file.Flush()
+	fname1 := fileName()
+	if fname1 == fname0 {
+		t.Fatalf("file not rotated at the hour: %s", fname1)
+	}
+
+	f0, err := os.ReadFile(fname0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(f0), "same hour") || strings.Contains(string(f0), "next hour") {
+		t.Errorf("%s holds the wrong entries:\n%s", fname0, f0)
+	}
+	if !strings.Contains(string(f0), "Next log: "+fname1) {
+		t.Errorf("%s does not chain to %s:\n%s", fname0, fname1, f0)
+	}
+	f1, err := os.ReadFile(fname1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(f1), "Previous log: "+fname0) || !strings.Contains(string(f1), "next hour") {
+		t.Errorf("%s does not chain to %s or lacks the new entry:\n%s", fname1, fname0, f1)
+	}
+}
@@ -0,0 +1,154 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Shutting down and restarting the file sink.
+
+package glog
+
+import (
+	"context"
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+// defaultFlushInterval is the interval at which log files are flushed when
+// -log_flush_interval is not positive.
+const defaultFlushInterval = 30 * time.Second
+
+var logFlushInterval = flag.Duration(glogFlag("log_flush_interval"), defaultFlushInterval, "interval at which buffered log entries are flushed to log files")
+
+// flushInterval returns the interval at which the flushDaemon flushes.
+func flushInterval() time.Duration {
+	if d := *logFlushInterval; d > 0 {
+		return d
+	}
+	return defaultFlushInterval
+}
+
+// Shutdown stops writing log files: it flushes the entries queued for
+// asynchronous sinks, waits for rotated files to be compressed and for the
+// space of -log_disk_reserve to be reserved, stops the goroutine that
+// periodically flushes log files, unmaps the -log_flight_recorder_size file,
+// then flushes, syncs and closes every log file.  It returns the errors encountered, or ctx.Err() if
+// ctx is done before the background work completes; the files are closed in
+// either case.
+//
+// Entries logged after Shutdown are not written to log files, but still to
+// standard error according to the flags.  RestartFileSink resumes writing log
+// files.
+func Shutdown(ctx context.Context) error {
+	s := &sinks.file
+	s.shutdown.Store(true)
+
+	var errs []error
+	if err := wait(ctx, drainAsyncSinks); err != nil {
+		errs = append(errs, err)
+	}
+	if err := wait(ctx, compressions.Wait); err != nil {
+		errs = append(errs, err)
+	}
+	if err := wait(ctx, reservations.Wait); err != nil {
+		errs = append(errs, err)
+	}
+
+	s.mu.Lock()
+	stop, stopped := s.stopFlush, s.flushStopped
+	s.stopFlush, s.flushStopped = nil, nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		if err := wait(ctx, func() { <-stopped }); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := sinks.flight.close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sb := range s.syncBuffers() {
+		if sb.file == nil {
+			continue
+		}
+		if err := sb.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := sb.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := sb.file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.file = severityWriters{}
+	s.single = nil
+	s.diskFull.releaseReserves()
+	return logsink.JoinErrors(errs...)
+}
+
+// wait calls f and waits for it to return, or for ctx to be done.
+func wait(ctx context.Context, f func()) error {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RestartFileSink resumes writing log files after Shutdown.  Log directories
+// are chosen again from -log_dir, and new log files are created when entries
+// are next logged, so that, for example, a test can direct the logs to a new
+// temporary directory.  The log files open when RestartFileSink is called
+// without a prior Shutdown are closed.
+func RestartFileSink() {
+	s := &sinks.file
+	s.mu.Lock()
+
+	for _, sb := range s.syncBuffers() {
+		if sb.file != nil {
+			sb.Flush()
+			sb.file.Close()
+		}
+	}
+	s.file = severityWriters{}
+	s.single = nil
+	s.diskFull.releaseReserves()
+	s.diskFull = diskFullState{}
+
+	logDirs = nil
+	onceLogDirs = sync.Once{}
+
+	if s.stopFlush == nil {
+		s.startFlushDaemon()
+	}
+	s.shutdown.Store(false)
+	s.mu.Unlock()
+
+	// Like the log files, the flight recorder file is created anew in the log
+	// directory.
+	sinks.flight.reset()
+}
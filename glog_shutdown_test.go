@@ -0,0 +1,63 @@
+package glog
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestShutdownAndRestart(t *testing.T) {
+	setFlags()
+	useLogDir(t, t.TempDir())
+
+	Info("before shutdown")
+	names, err := Names("INFO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(names[0], *logDir) {
+		t.Errorf("Names(INFO) = %v, want files in -log_dir=%s", names, *logDir)
+	}
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	b, err := os.ReadFile(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), "] before shutdown\n") {
+		t.Errorf("%s has contents:\n%s\nwant the entry logged before Shutdown", names[0], b)
+	}
+	sinks.file.mu.Lock()
+	stopped := sinks.file.stopFlush == nil
+	sinks.file.mu.Unlock()
+	if !stopped {
+		t.Error("flush daemon still running after Shutdown")
+	}
+
+	Info("after shutdown")
+	if _, err := Names("INFO"); err != ErrNoLog {
+		t.Errorf("Names(INFO) after Shutdown returned error %v, want ErrNoLog", err)
+	}
+
+	*logDir = t.TempDir()
+	RestartFileSink()
+	Info("after restart")
+	restarted, err := Names("INFO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(restarted[0], *logDir) {
+		t.Errorf("Names(INFO) after RestartFileSink = %v, want files in the new -log_dir=%s", restarted, *logDir)
+	}
+	Flush()
+	b, err = os.ReadFile(restarted[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "after shutdown") || !strings.HasSuffix(string(b), "] after restart\n") {
+		t.Errorf("%s has contents:\n%s\nwant only the entry logged after RestartFileSink", restarted[0], b)
+	}
+}
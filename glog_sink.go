@@ -0,0 +1,186 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Registration of additional log destinations.
+
+package glog
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+// Meta is metadata about a logging call, as passed to sinks.
+type Meta = logsink.Meta
+
+// A Severity is a severity at which a message can be logged.
+type Severity = logsink.Severity
+
+// These constants identify the log severities in order of increasing severity.
+const (
+	SeverityInfo    = logsink.Info
+	SeverityWarning = logsink.Warning
+	SeverityError   = logsink.Error
+	SeverityFatal   = logsink.Fatal
+)
+
+// StructuredSink is a logging destination that accepts structured data
+// (metadata, a format string and its arguments) as input.
+//
+// See the documentation of the methods of logsink.Structured for the
+// contract a sink must follow.
+type StructuredSink = logsink.Structured
+
+// TextSink is a logging destination that accepts pre-formatted log lines,
+// including the standard glog header.
+//
+// A TextSink may implement CustomFormatter to receive entries encoded by a
+// Formatter of its choice instead.
+type TextSink = logsink.Text
+
+// A Formatter encodes log entries for TextSinks.
+//
+// See the documentation of logsink.Formatter for the contract a Formatter must
+// follow.
+type Formatter = logsink.Formatter
+
+// CustomFormatter can be implemented by a TextSink to choose the Formatter for
+// the entries it receives.
+type CustomFormatter = logsink.CustomFormatter
+
+// The built-in Formatters.
+var (
+	// GlogFormatter encodes entries in the classic glog format, with a header
+	// of the form "Lmmdd hh:mm:ss.uuuuuu threadid file:line] ".
+	GlogFormatter = logsink.GlogFormatter
+
+	// JSONFormatter encodes each entry as a JSON object on a single line, as
+	// selected by -log_format=json.
+	JSONFormatter = logsink.JSONFormatter
+)
+
+// SetFormatter sets the Formatter for all TextSinks that don't choose their
+// own, including the built-in file and stderr sinks unless -log_format,
+// SetFileFormatter or SetStderrFormatter choose another.  A nil f restores
+// GlogFormatter.
+func SetFormatter(f Formatter) {
+	logsink.SetFormatter(f)
+}
+
+// SetFileFormatter sets the Formatter for the log files, overriding
+// -log_format.  A nil f undoes a previous call.
+func SetFileFormatter(f Formatter) {
+	sinks.file.formatter.set(f)
+}
+
+// SetStderrFormatter sets the Formatter for entries written to stderr,
+// overriding -log_format.  A nil f undoes a previous call.
+func SetStderrFormatter(f Formatter) {
+	sinks.stderr.formatter.set(f)
+}
+
+// sinkFormatter holds the Formatter chosen for one of the built-in sinks.
+type sinkFormatter struct {
+	f atomic.Pointer[logsink.Formatter]
+}
+
+func (sf *sinkFormatter) set(f logsink.Formatter) {
+	if f == nil {
+		sf.f.Store(nil)
+		return
+	}
+	sf.f.Store(&f)
+}
+
+// get returns the Formatter set for the sink, or else the one selected by
+// -log_format, or nil if the sink should use the global Formatter.
+func (sf *sinkFormatter) get() logsink.Formatter {
+	if f := sf.f.Load(); f != nil {
+		return *f
+	}
+	if f := logFormat.get(); f != logsink.GlogFormatter {
+		return f
+	}
+	return nil
+}
+
+// StackWanter can be implemented by a StructuredSink to indicate that it
+// wants a stack trace to accompany at least some of the log messages it
+// receives.
+type StackWanter = logsink.StackWanter
+
+// SinkHandle identifies a sink added with RegisterSink or RegisterTextSink.
+type SinkHandle struct {
+	reg *logsink.Registration
+
+	// onUnregister, if non-nil, is called the first time the handle is passed
+	// to UnregisterSink.
+	onUnregister func()
+	once         sync.Once
+}
+
+// RegisterSink adds s to the destinations to which all subsequent log entries
+// are written.  It may be called at any time, including concurrently with
+// logging calls.
+//
+// The returned handle can be passed to UnregisterSink to remove the sink.  If
+// s is nil, RegisterSink does nothing and returns nil.
+func RegisterSink(s StructuredSink) *SinkHandle {
+	if s == nil {
+		return nil
+	}
+	return &SinkHandle{reg: logsink.RegisterStructured(s)}
+}
+
+// RegisterTextSink adds s to the destinations to which all subsequent log
+// entries are written, as pre-formatted text.  It may be called at any time,
+// including concurrently with logging calls.
+//
+// The returned handle can be passed to UnregisterSink to remove the sink.  If
+// s is nil, RegisterTextSink does nothing and returns nil.
+func RegisterTextSink(s TextSink) *SinkHandle {
+	if s == nil {
+		return nil
+	}
+	return &SinkHandle{reg: logsink.RegisterText(s)}
+}
+
+// UnregisterSink removes the sink identified by h.  Unregistering a sink more
+// than once, or a nil handle, has no effect.
+//
+// A logging call that is already in progress may still write to the sink
+// after UnregisterSink returns.
+func UnregisterSink(h *SinkHandle) {
+	if h == nil {
+		return
+	}
+	logsink.Unregister(h.reg)
+	if h.onUnregister != nil {
+		h.once.Do(h.onUnregister)
+	}
+}
+
+// builtinSinksDisabled is the number of active reasons (such as RedirectToSlog
+// handles) for which the built-in file and stderr sinks should not write.
+var builtinSinksDisabled atomic.Int32
+
+// builtinSinksEnabled reports whether the built-in file and stderr sinks
+// should write log entries.
+func builtinSinksEnabled() bool {
+	return builtinSinksDisabled.Load() == 0
+}
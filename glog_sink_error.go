@@ -0,0 +1,154 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Handling of errors returned by sinks.
+
+package glog
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+// A SinkError describes an error returned by a sink.
+type SinkError = logsink.SinkError
+
+// sinkErrorHandler holds the function set with SetSinkErrorHandler.
+var sinkErrorHandler atomic.Pointer[func(*SinkError)]
+
+// SetSinkErrorHandler arranges for h to be called with each error returned by
+// a sink, before the -log_sink_error_policy flag is applied.  It may be used to
+// export sink failures as metrics.  A nil h removes the handler.
+//
+// h is called on the goroutine of the logging call that observed the error,
+// and must not block or log through glog.
+func SetSinkErrorHandler(h func(err *SinkError)) {
+	if h == nil {
+		sinkErrorHandler.Store(nil)
+		return
+	}
+	sinkErrorHandler.Store(&h)
+}
+
+// stderrFallback is set when the -log_sink_error_policy=stderr has redirected
+// the output of a failed sink to stderr.
+var stderrFallback atomic.Bool
+
+// Bounds of the interval for which -log_sink_error_policy=retry disables a
+// failing sink.
+const (
+	minSinkRetryInterval = time.Second
+	maxSinkRetryInterval = 5 * time.Minute
+)
+
+// sinkFailure records the failures of a sink.
+type sinkFailure struct {
+	last    time.Time     // Time of the last failure.
+	backoff time.Duration // Interval for which the sink was last disabled.
+}
+
+var sinkFailures struct {
+	mu sync.Mutex
+	m  map[any]*sinkFailure
+}
+
+// handleSinkError applies -log_sink_error_policy to err, as returned by
+// logsink.Printf.
+func handleSinkError(err error) {
+	errs := logsink.SinkErrors(err)
+	if len(errs) == 0 {
+		errs = []*SinkError{{Err: err}}
+	}
+	if h := sinkErrorHandler.Load(); h != nil {
+		for _, e := range errs {
+			(*h)(e)
+		}
+	}
+
+	policy := sinkErrPolicy.get()
+	for _, e := range errs {
+		if policy == abortOnSinkError || e.Sink == nil || !isolateSink(policy, e) {
+			abortForSinkError(err)
+			return
+		}
+	}
+}
+
+// isolateSink stops writing to the sink that returned e, as selected by
+// policy, and reports the failure to the remaining sinks.  It returns false if
+// the sink cannot be disabled.
+func isolateSink(policy sinkErrorPolicy, e *SinkError) bool {
+	if !reflect.TypeOf(e.Sink).Comparable() {
+		return false
+	}
+	now := timeNow()
+
+	sinkFailures.mu.Lock()
+	if sinkFailures.m == nil {
+		sinkFailures.m = make(map[any]*sinkFailure)
+	}
+	f, seen := sinkFailures.m[e.Sink]
+	if !seen {
+		f = &sinkFailure{}
+		sinkFailures.m[e.Sink] = f
+	}
+	var until time.Time
+	if policy == retryOnSinkError {
+		if f.backoff == 0 || now.Sub(f.last) > 2*f.backoff {
+			f.backoff = minSinkRetryInterval
+		} else if f.backoff *= 2; f.backoff > maxSinkRetryInterval {
+			f.backoff = maxSinkRetryInterval
+		}
+		until = now.Add(f.backoff)
+	}
+	f.last = now
+	backoff := f.backoff
+	sinkFailures.mu.Unlock()
+
+	if !logsink.Disable(e.Sink, until) {
+		return false
+	}
+	switch policy {
+	case disableOnSinkError:
+		if !seen {
+			reportSinkError("log: disabling sink after error: %v", e)
+		}
+	case stderrOnSinkError:
+		stderrFallback.Store(true)
+		if !seen {
+			reportSinkError("log: writing to stderr instead of sink after error: %v", e)
+		}
+	case retryOnSinkError:
+		reportSinkError("log: disabling sink for %v after error: %v", backoff, e)
+	}
+	return true
+}
+
+// reportSinkError logs an ERROR message to the sinks that are still enabled.
+func reportSinkError(format string, args ...any) {
+	m := &logsink.Meta{}
+	m.Time = timeNow()
+	m.Severity = logsink.Error
+	m.Thread = int64(pid)
+	_, m.File, m.Line, _ = runtime.Caller(0)
+	// Errors from the remaining sinks are handled when they next log.
+	logsink.Printf(m, format, args...)
+}
@@ -0,0 +1,125 @@
+package glog
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+// failingTextSink is a TextSink that counts its calls and fails them all.
+type failingTextSink struct {
+	calls int
+}
+
+var errSinkFull = errors.New("no space left on device")
+
+func (s *failingTextSink) Enabled(*Meta) bool { return true }
+
+func (s *failingTextSink) Emit(*Meta, []byte) (int, error) {
+	s.calls++
+	return 0, errSinkFull
+}
+
+// setSinkErrorPolicy sets -log_sink_error_policy for the duration of a test.
+func setSinkErrorPolicy(t *testing.T, policy string) {
+	t.Helper()
+	if err := flag.Lookup("log_sink_error_policy").Value.Set(policy); err != nil {
+		t.Fatalf("Failed to set -log_sink_error_policy=%s: %v", policy, err)
+	}
+	t.Cleanup(func() {
+		flag.Lookup("log_sink_error_policy").Value.Set("abort")
+		stderrFallback.Store(false)
+		sinkFailures.mu.Lock()
+		sinkFailures.m = nil
+		sinkFailures.mu.Unlock()
+	})
+}
+
+func TestSinkErrorPolicyDisable(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	setSinkErrorPolicy(t, "disable")
+
+	var handled []*SinkError
+	SetSinkErrorHandler(func(err *SinkError) { handled = append(handled, err) })
+	defer SetSinkErrorHandler(nil)
+
+	failing := &failingTextSink{}
+	handle := RegisterTextSink(failing)
+	defer UnregisterSink(handle)
+	defer logsink.Enable(failing)
+
+	Info("first")
+	Info("second")
+	if failing.calls != 1 {
+		t.Errorf("failing sink called %d times, want 1", failing.calls)
+	}
+	if len(handled) != 1 || handled[0].Sink != failing || !errors.Is(handled[0], errSinkFull) {
+		t.Errorf("sink error handler got %v, want one error from the failing sink", handled)
+	}
+	if got := strings.Count(contents(SeverityError), "disabling sink"); got != 1 {
+		t.Errorf("ERROR log reports the failure %d times, want 1: %q", got, contents(SeverityError))
+	}
+	if !contains(SeverityInfo, "second", t) {
+		t.Errorf("INFO log = %q, want it to contain the entry logged after the failure", contents(SeverityInfo))
+	}
+}
+
+func TestSinkErrorPolicyStderr(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	setSinkErrorPolicy(t, "stderr")
+	var stderr bytes.Buffer
+	sinks.stderr.w = &stderr
+	defer func() { sinks.stderr.w = nil }()
+
+	failing := &failingTextSink{}
+	handle := RegisterTextSink(failing)
+	defer UnregisterSink(handle)
+	defer logsink.Enable(failing)
+
+	Info("first")
+	Info("second")
+	if !strings.Contains(stderr.String(), "] second") {
+		t.Errorf("stderr got %q, want INFO entries after the failure", stderr.String())
+	}
+}
+
+func TestSinkErrorPolicyRetry(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	setSinkErrorPolicy(t, "retry")
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time { return now }
+
+	failing := &failingTextSink{}
+	handle := RegisterTextSink(failing)
+	defer UnregisterSink(handle)
+	defer logsink.Enable(failing)
+
+	for _, step := range []struct {
+		advance   time.Duration
+		wantCalls int
+	}{
+		{0, 1},                              // Fails, disabled for 1s.
+		{500 * time.Millisecond, 1},         // Still disabled.
+		{time.Second, 2},                    // Retried, fails, disabled for 2s.
+		{time.Second, 2},                    // Still disabled.
+		{time.Second + time.Millisecond, 3}, // Retried.
+		{time.Hour, 4},                      // Retried; the backoff is reset.
+		{time.Second, 5},                    // Retried after 1s.
+	} {
+		now = now.Add(step.advance)
+		Info("retry")
+		if failing.calls != step.wantCalls {
+			t.Fatalf("after %v: failing sink called %d times, want %d", step.advance, failing.calls, step.wantCalls)
+		}
+	}
+}
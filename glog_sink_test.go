@@ -0,0 +1,178 @@
+package glog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// countingSink is a StructuredSink that counts the calls made to it.
+type countingSink struct {
+	mu     sync.Mutex
+	calls  int
+	format string
+}
+
+func (s *countingSink) Printf(meta *Meta, format string, args ...any) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	s.format = format
+	return 0, nil
+}
+
+func (s *countingSink) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// Test that a registered sink receives log entries until it is unregistered.
+func TestRegisterSink(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	sink := &countingSink{}
+	h := RegisterSink(sink)
+	Info("registered")
+	if got, want := sink.Calls(), 1; got != want {
+		t.Errorf("sink.Calls() = %d after one log call, want %d", got, want)
+	}
+
+	UnregisterSink(h)
+	UnregisterSink(h) // Must be a no-op.
+	Info("unregistered")
+	if got, want := sink.Calls(), 1; got != want {
+		t.Errorf("sink.Calls() = %d after UnregisterSink, want %d", got, want)
+	}
+}
+
+// Test that nil sinks are not registered, and that a nil handle can be
+// unregistered.
+func TestRegisterNilSink(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	if h := RegisterSink(nil); h != nil {
+		t.Errorf("RegisterSink(nil) = %v, want nil", h)
+	}
+	if h := RegisterTextSink(nil); h != nil {
+		t.Errorf("RegisterTextSink(nil) = %v, want nil", h)
+	}
+	UnregisterSink(nil) // Must be a no-op.
+	Info("after nil sinks")
+	if !contains(SeverityInfo, "after nil sinks", t) {
+		t.Errorf("Info log has %q, want the entry logged after registering nil sinks", contents(SeverityInfo))
+	}
+}
+
+// savingTextSink is a TextSink that saves every entry written to it.
+type savingTextSink struct {
+	mu   sync.Mutex
+	data []string
+}
+
+func (s *savingTextSink) Enabled(*Meta) bool { return true }
+
+func (s *savingTextSink) Emit(meta *Meta, data []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = append(s.data, string(data))
+	return len(data), nil
+}
+
+func (s *savingTextSink) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.data, "")
+}
+
+// Test that a registered Text sink receives the same formatted entry as the
+// file sink.
+func TestRegisterTextSink(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	sink := &savingTextSink{}
+	h := RegisterTextSink(sink)
+	defer UnregisterSink(h)
+
+	Warning("text sink test")
+	if got, want := sink.String(), contents(SeverityInfo); got != want {
+		t.Errorf("text sink got %q, want %q", got, want)
+	}
+}
+
+// Test that sinks can be registered and unregistered while other goroutines
+// are logging.  Run with -race to detect unsynchronized access.
+func TestRegisterSinkConcurrent(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newDiscarders())
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				Info("concurrent")
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		UnregisterSink(RegisterSink(&countingSink{}))
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// shortFormatter is a Formatter that writes only the severity and message.
+type shortFormatter struct{}
+
+func (shortFormatter) Format(buf *bytes.Buffer, m *Meta, msg []byte) {
+	fmt.Fprintf(buf, "%s: %s\n", m.Severity, msg)
+}
+
+// Test that the built-in sinks can be given different Formatters.
+func TestSetStderrFormatter(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	var stderr bytes.Buffer
+	sinks.stderr.w = &stderr
+	defer func() { sinks.stderr.w = nil }()
+	alsoToStderr = true
+	defer func() { alsoToStderr = false }()
+
+	SetStderrFormatter(shortFormatter{})
+	defer SetStderrFormatter(nil)
+	Warning("formatted")
+	if got, want := stderr.String(), "WARNING: formatted\n"; got != want {
+		t.Errorf("stderr got %q, want %q", got, want)
+	}
+	if !contains(SeverityWarning, "glog_sink_test.go", t) {
+		t.Errorf("WARNING log = %q, want glog header", contents(SeverityWarning))
+	}
+
+	SetFormatter(shortFormatter{})
+	defer SetFormatter(nil)
+	SetFileFormatter(GlogFormatter)
+	defer SetFileFormatter(nil)
+	sinks.file.resetBuffers()
+	Error("global")
+	if !contains(SeverityError, "glog_sink_test.go", t) {
+		t.Errorf("ERROR log = %q, want glog header from SetFileFormatter", contents(SeverityError))
+	}
+	SetFileFormatter(nil)
+	sinks.file.resetBuffers()
+	Error("global")
+	if got, want := contents(SeverityError), "ERROR: global\n"; got != want {
+		t.Errorf("ERROR log = %q, want %q from SetFormatter", got, want)
+	}
+}
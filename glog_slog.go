@@ -0,0 +1,311 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Interoperability with the log/slog package, which requires Go 1.21.
+
+//go:build go1.21
+
+package glog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/glog/internal/logsink"
+)
+
+// SlogHandlerOptions are options for a handler returned by NewSlogHandler.
+// A zero SlogHandlerOptions consists entirely of default values.
+type SlogHandlerOptions struct {
+	// Level reports the minimum record level that will be logged.
+	// If Level is nil, the handler logs records at all levels, subject to the
+	// -v and -vmodule flags for levels below slog.LevelInfo.
+	Level slog.Leveler
+}
+
+// NewSlogHandler returns an slog.Handler that writes records to the glog sinks.
+//
+// Record levels map onto glog severities as follows:
+//
+//	slog.LevelError and above:          ERROR
+//	slog.LevelWarn up to LevelError:    WARNING
+//	slog.LevelInfo up to LevelWarn:     INFO
+//	below slog.LevelInfo:               INFO, logged as V(slog.LevelInfo - level)
+//
+// so slog.LevelDebug records are logged as V(4) and only appear if -v or
+// -vmodule enables that level for the file containing the logging call.
+//
+// The file:line in the log header is taken from the record's PC, so it refers
+// to the caller of the slog.Logger method rather than to the handler.
+//
+// Attributes are passed to sinks as key/value pairs, as for InfoS, with keys
+// qualified by the names of their groups (as in "group.key").
+func NewSlogHandler(opts *SlogHandlerOptions) slog.Handler {
+	h := &slogHandler{}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// slogHandler is the slog.Handler returned by NewSlogHandler.
+type slogHandler struct {
+	opts SlogHandlerOptions
+
+	// attrs are the attributes added with WithAttrs, with group-qualified keys.
+	// They are passed to sinks as logsink.Meta.KeysAndValues, followed by those
+	// of each record.
+	attrs []slog.Attr
+	// prefix is the key prefix ("group1.group2.") for attributes added in the
+	// current group.
+	prefix string
+}
+
+// slogSeverity maps an slog.Level to a severity and, for levels below
+// slog.LevelInfo, the V level at which the record should be logged.
+func slogSeverity(level slog.Level) (logsink.Severity, Level) {
+	switch {
+	case level >= slog.LevelError:
+		return logsink.Error, 0
+	case level >= slog.LevelWarn:
+		return logsink.Warning, 0
+	case level >= slog.LevelInfo:
+		return logsink.Info, 0
+	}
+	return logsink.Info, Level(slog.LevelInfo - level)
+}
+
+// Enabled implements slog.Handler.Enabled.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if h.opts.Level != nil && level < h.opts.Level.Level() {
+		return false
+	}
+	_, v := slogSeverity(level)
+	if v == 0 {
+		return true
+	}
+	if atomic.LoadInt32(&vflags.moduleLength) > 0 {
+		// The caller is not known yet: Handle checks -vmodule using the
+		// record's PC.
+		return true
+	}
+	return Level(atomic.LoadInt32((*int32)(&vflags.v))) >= v
+}
+
+// Handle implements slog.Handler.Handle.
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	severity, v := slogSeverity(r.Level)
+	if v > 0 && !vflags.enabledPC(r.PC, v) {
+		return nil
+	}
+
+	file, line := "???", 1
+	if r.PC != 0 {
+		pcs := [1]uintptr{r.PC}
+		frame, _ := runtime.CallersFrames(pcs[:]).Next()
+		if frame.File != "" {
+			file, line = frame.File, frame.Line
+		}
+	}
+	now := r.Time
+	if now.IsZero() {
+		now = timeNow()
+	}
+
+	attrs := h.attrs
+	if r.NumAttrs() > 0 {
+		attrs = append([]slog.Attr(nil), h.attrs...)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = appendSlogAttr(attrs, h.prefix, a)
+			return true
+		})
+	}
+	var kv []any
+	if len(attrs) > 0 {
+		kv = make([]any, 0, 2*len(attrs))
+		for _, a := range attrs {
+			kv = append(kv, a.Key, a.Value.Any())
+		}
+	}
+
+	format, args := "%s", []any{r.Message}
+	if backtraceAt(file, line) {
+		format, args = appendBacktrace(1, format, args)
+	}
+
+	metai, meta := metaPoolGet()
+	*meta = logsink.Meta{
+		Context: ctx,
+		Time:    now,
+		File:    file,
+		Line:    line,
+		// The depth of the logging call is not known, so stack traces start
+		// at the caller of Handle.
+		Depth:    1,
+		Severity: severity,
+		Verbose:  v > 0,
+		Thread:   int64(pid),
+
+		KeysAndValues: kv,
+	}
+	sinkf(meta, format, args...)
+	meta.Context = nil
+	meta.Stack = nil
+	meta.KeysAndValues = nil
+	metaPool.Put(metai)
+	return nil
+}
+
+// WithAttrs implements slog.Handler.WithAttrs.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = appendSlogAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup implements slog.Handler.WithGroup.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// appendSlogAttr appends a to attrs, flattening groups into attributes whose
+// keys are qualified by the group names (as in "group.key").
+func appendSlogAttr(attrs []slog.Attr, prefix string, a slog.Attr) []slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			attrs = appendSlogAttr(attrs, prefix, ga)
+		}
+		return attrs
+	}
+	a.Key = prefix + a.Key
+	return append(attrs, a)
+}
+
+// SlogSink is a StructuredSink that forwards each log entry to an
+// slog.Handler as an slog.Record.
+//
+// Severities map onto slog levels as follows: INFO to slog.LevelInfo (or
+// slog.LevelDebug for V logs), WARNING to slog.LevelWarn, ERROR to
+// slog.LevelError and FATAL to slog.LevelError+4.
+//
+// The handler must not itself write to glog (for example, it must not be a
+// handler returned by NewSlogHandler): that would loop forever.
+type SlogSink struct {
+	handler slog.Handler
+}
+
+// NewSlogSink returns a SlogSink that forwards log entries to h.
+// Use RegisterSink to start forwarding, or RedirectToSlog to also stop writing
+// to the built-in file and stderr sinks.
+func NewSlogSink(h slog.Handler) *SlogSink {
+	return &SlogSink{handler: h}
+}
+
+// slogLevel maps a severity to an slog.Level.
+func slogLevel(severity logsink.Severity, verbose bool) slog.Level {
+	switch severity {
+	case logsink.Warning:
+		return slog.LevelWarn
+	case logsink.Error:
+		return slog.LevelError
+	case logsink.Fatal:
+		return slog.LevelError + 4
+	}
+	if verbose {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// Printf implements StructuredSink.Printf.
+func (s *SlogSink) Printf(meta *Meta, format string, args ...any) (n int, err error) {
+	ctx := meta.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	level := slogLevel(meta.Severity, meta.Verbose)
+	if !s.handler.Enabled(ctx, level) {
+		return 0, nil
+	}
+
+	// The backtrace, if any, goes only in the "stack" attribute.
+	format, args, stack := logsink.SplitStack(format, args)
+	if meta.Stack != nil {
+		stack = meta.Stack
+	}
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	r := slog.NewRecord(meta.Time, level, msg, slogSinkPC(meta))
+	r.Add(meta.KeysAndValues...)
+	if stack != nil {
+		r.AddAttrs(slog.String("stack", stack.String()))
+	}
+	if err := s.handler.Handle(ctx, r); err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
+
+// slogSinkPC returns the program counter of the logging call described by
+// meta, or 0 if it cannot be found.  It must be called directly from
+// SlogSink.Printf.
+func slogSinkPC(meta *Meta) uintptr {
+	// Skip runtime.Callers, slogSinkPC and SlogSink.Printf; meta.Depth frames
+	// further up is the logging call.
+	var pcs [1]uintptr
+	if runtime.Callers(meta.Depth+3, pcs[:]) < 1 {
+		return 0
+	}
+	// Entries that did not come from a logging call in this process (for
+	// example, those imported by the standard "log" bridge) may not match the
+	// stack: don't report a misleading source location for them.
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	if frame.File != meta.File || frame.Line != meta.Line {
+		return 0
+	}
+	return pcs[0]
+}
+
+// RedirectToSlog registers a SlogSink for h and stops writing log entries to
+// the built-in file and stderr sinks, so that all glog output ends up in h.
+// Passing the returned handle to UnregisterSink undoes both.
+func RedirectToSlog(h slog.Handler) *SinkHandle {
+	builtinSinksDisabled.Add(1)
+	handle := RegisterSink(NewSlogSink(h))
+	handle.onUnregister = func() { builtinSinksDisabled.Add(-1) }
+	return handle
+}
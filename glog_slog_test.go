@@ -0,0 +1,206 @@
+//go:build go1.21
+
+package glog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Test that records logged through NewSlogHandler reach the glog sinks with
+// the right severity, header and attributes.
+func TestSlogHandler(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	logger := slog.New(NewSlogHandler(nil))
+	for _, test := range []struct {
+		name string
+		log  func()
+		sev  Severity
+		want string
+	}{
+		{
+			name: "info",
+			log:  func() { logger.Info("hello", "k", 1) },
+			sev:  SeverityInfo,
+			want: "] hello k=1\n",
+		},
+		{
+			name: "warn",
+			log:  func() { logger.Warn("careful") },
+			sev:  SeverityWarning,
+			want: "] careful\n",
+		},
+		{
+			name: "error with attrs and groups",
+			log: func() {
+				logger.With("a", "x").WithGroup("g").Error("failed", "b", true, slog.Group("h", "c", 2))
+			},
+			sev:  SeverityError,
+			want: "] failed a=\"x\" g.b=true g.h.c=2\n",
+		},
+	} {
+		sinks.file.resetBuffers()
+		test.log()
+		if got := contents(test.sev); len(got) == 0 || got[0] != "IWEF"[test.sev] {
+			t.Errorf("%s: %v log has wrong severity character: %q", test.name, test.sev, got)
+		}
+		if !contains(test.sev, test.want, t) {
+			t.Errorf("%s: %v log = %q, want it to contain %q", test.name, test.sev, contents(test.sev), test.want)
+		}
+	}
+}
+
+// Test that the log header refers to the caller of the slog.Logger method.
+func TestSlogHandlerSource(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	logger := slog.New(NewSlogHandler(nil))
+	_, _, line, _ := runtime.Caller(0)
+	logger.Info("source") // Must stay on the line after runtime.Caller.
+	want := fmt.Sprintf("glog_slog_test.go:%d] source", line+1)
+	if !contains(SeverityInfo, want, t) {
+		t.Errorf("INFO log = %q, want it to contain %q", contents(SeverityInfo), want)
+	}
+}
+
+// Test that debug records obey -v and -vmodule.
+func TestSlogHandlerVerbosity(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	logger := slog.New(NewSlogHandler(nil))
+	logger.Debug("hidden")
+	if got := contents(SeverityInfo); got != "" {
+		t.Errorf("Debug logged with -v=0: %q", got)
+	}
+
+	if err := flag.Lookup("v").Value.Set("4"); err != nil {
+		t.Fatalf("Failed to set -v=4: %v", err)
+	}
+	logger.Debug("shown by v")
+	flag.Lookup("v").Value.Set("0")
+	if !contains(SeverityInfo, "shown by v", t) {
+		t.Errorf("Debug not logged with -v=4: %q", contents(SeverityInfo))
+	}
+
+	if err := flag.Lookup("vmodule").Value.Set("glog_slog_test=4"); err != nil {
+		t.Fatalf("Failed to set -vmodule=glog_slog_test=4: %v", err)
+	}
+	defer flag.Lookup("vmodule").Value.Set("")
+	logger.Debug("shown by vmodule")
+	logger.Log(context.Background(), slog.LevelDebug-1, "too verbose")
+	if !contains(SeverityInfo, "shown by vmodule", t) {
+		t.Errorf("Debug not logged with -vmodule=glog_slog_test=4: %q", contents(SeverityInfo))
+	}
+	if contains(SeverityInfo, "too verbose", t) {
+		t.Errorf("V(5) record logged with -vmodule=glog_slog_test=4: %q", contents(SeverityInfo))
+	}
+}
+
+// Test that SlogHandlerOptions.Level filters records.
+func TestSlogHandlerLevel(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	logger := slog.New(NewSlogHandler(&SlogHandlerOptions{Level: slog.LevelWarn}))
+	logger.Info("filtered")
+	if got := contents(SeverityInfo); got != "" {
+		t.Errorf("Info logged with Level = LevelWarn: %q", got)
+	}
+}
+
+// Test that SlogSink forwards entries with the right level, message and source.
+func TestSlogSink(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	var buf bytes.Buffer
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		AddSource: true,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch a.Key {
+			case slog.TimeKey:
+				return slog.Attr{}
+			case slog.SourceKey:
+				src := a.Value.Any().(*slog.Source)
+				return slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+			}
+			return a
+		},
+	})
+	handle := RegisterSink(NewSlogSink(h))
+	defer UnregisterSink(handle)
+
+	_, _, line, _ := runtime.Caller(0)
+	Warningf("forwarded %d", 1) // Must stay on the line after runtime.Caller.
+	want := fmt.Sprintf("level=WARN source=glog_slog_test.go:%d msg=\"forwarded 1\"\n", line+1)
+	if got := buf.String(); got != want {
+		t.Errorf("slog handler got %q, want %q", got, want)
+	}
+}
+
+// Test that SlogSink reports a backtrace only in the "stack" attribute, not in
+// the message.
+func TestSlogSinkStack(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	defer logBacktraceAt.Set("")
+
+	var buf bytes.Buffer
+	handle := RedirectToSlog(slog.NewJSONHandler(&buf, nil))
+	defer UnregisterSink(handle)
+
+	_, _, line, _ := runtime.Caller(0)
+	if err := logBacktraceAt.Set(fmt.Sprintf("glog_slog_test.go:%d", line+4)); err != nil {
+		t.Fatal(err)
+	}
+	Info("traced") // Must stay 4 lines after runtime.Caller.
+
+	var record struct {
+		Msg   string `json:"msg"`
+		Stack string `json:"stack"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", buf.String(), err)
+	}
+	if record.Msg != "traced" {
+		t.Errorf("msg = %q, want %q", record.Msg, "traced")
+	}
+	if !strings.Contains(record.Stack, "TestSlogSinkStack") {
+		t.Errorf("stack = %q, want a backtrace of TestSlogSinkStack", record.Stack)
+	}
+}
+
+// Test that RedirectToSlog disables the built-in sinks until unregistered.
+func TestRedirectToSlog(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	var buf bytes.Buffer
+	handle := RedirectToSlog(slog.NewTextHandler(&buf, nil))
+	Info("redirected")
+	if !strings.Contains(buf.String(), "msg=redirected") {
+		t.Errorf("slog handler got %q, want it to contain %q", buf.String(), "msg=redirected")
+	}
+	if got := contents(SeverityInfo); got != "" {
+		t.Errorf("file sink got %q while redirected, want nothing", got)
+	}
+
+	UnregisterSink(handle)
+	UnregisterSink(handle)
+	Info("restored")
+	if !contains(SeverityInfo, "restored", t) {
+		t.Errorf("file sink got %q after UnregisterSink, want it to contain %q", contents(SeverityInfo), "restored")
+	}
+}
@@ -0,0 +1,90 @@
+package glog
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// savingSink is a StructuredSink that saves the key/value pairs of the last
+// entry written to it.
+type savingSink struct {
+	kv []any
+}
+
+func (s *savingSink) Printf(meta *Meta, format string, args ...any) (int, error) {
+	s.kv = append([]any(nil), meta.KeysAndValues...)
+	return 0, nil
+}
+
+// Test that the S functions render key/value pairs in text output and pass
+// them to Structured sinks unchanged.
+func TestInfoS(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	sink := &savingSink{}
+	defer UnregisterSink(RegisterSink(sink))
+
+	funcs := map[string]func(msg string, kv ...any){
+		"InfoS":             InfoS,
+		"InfoDepthS":        func(msg string, kv ...any) { InfoDepthS(0, msg, kv...) },
+		"InfoContextS":      func(msg string, kv ...any) { InfoContextS(context.Background(), msg, kv...) },
+		"InfoContextDepthS": func(msg string, kv ...any) { InfoContextDepthS(context.Background(), 0, msg, kv...) },
+	}
+	err := errors.New("oops")
+	for name, f := range funcs {
+		sinks.file.resetBuffers()
+		f("request done", "path", "/a b", "status", 200, "err", err, "dangling")
+		const want = `] request done path="/a b" status=200 err="oops" dangling=(MISSING)` + "\n"
+		if !contains(SeverityInfo, want, t) {
+			t.Errorf("%s: INFO log = %q, want it to contain %q", name, contents(SeverityInfo), want)
+		}
+		if wantKV := []any{"path", "/a b", "status", 200, "err", err, "dangling"}; !reflect.DeepEqual(sink.kv, wantKV) {
+			t.Errorf("%s: sink got KeysAndValues %v, want %v", name, sink.kv, wantKV)
+		}
+	}
+}
+
+// Test that ErrorS and WarningS write to the lower-severity logs as well.
+func TestErrorS(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+
+	ErrorS("failed", "attempt", 3)
+	WarningS("slow", "ms", 1500)
+	for _, want := range []struct {
+		sev Severity
+		str string
+	}{
+		{SeverityError, "] failed attempt=3\n"},
+		{SeverityWarning, "] failed attempt=3\n"},
+		{SeverityWarning, "] slow ms=1500\n"},
+		{SeverityInfo, "] slow ms=1500\n"},
+	} {
+		if !contains(want.sev, want.str, t) {
+			t.Errorf("%v log = %q, want it to contain %q", want.sev, contents(want.sev), want.str)
+		}
+	}
+}
+
+// Test that V(n).InfoS is guarded by the verbosity level.
+func TestVInfoS(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	if err := flag.Lookup("v").Value.Set("2"); err != nil {
+		t.Fatalf("Failed to set -v=2: %v", err)
+	}
+	defer flag.Lookup("v").Value.Set("0")
+
+	V(3).InfoS("hidden", "k", 1)
+	V(2).InfoS("shown", "k", 2)
+	if contains(SeverityInfo, "hidden", t) {
+		t.Errorf("V(3).InfoS logged with -v=2: %q", contents(SeverityInfo))
+	}
+	if !contains(SeverityInfo, "] shown k=2\n", t) {
+		t.Errorf("V(2).InfoS not logged with -v=2: %q", contents(SeverityInfo))
+	}
+}
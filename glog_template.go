@@ -0,0 +1,327 @@
+// Go support for leveled logs, analogous to https://github.com/google/glog.
+//
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Templates for the names of log files and their symlinks.
+
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The templates used when -log_file_template and -log_link_template are not
+// set.
+const (
+	defaultFileTemplate = "{program}.{host}.{user}.log.{tag}.{YYYY}{MM}{DD}-{hh}{mm}{ss}.{pid}"
+	defaultLinkTemplate = "{program}.{tag}"
+)
+
+// timeFields are the placeholders for components of the start time of a log
+// file, with the widths they are padded to.
+var timeFields = map[string]int{
+	"YYYY": 4,
+	"MM":   2,
+	"DD":   2,
+	"hh":   2,
+	"mm":   2,
+	"ss":   2,
+}
+
+// A templatePart is either a literal string or a placeholder.
+type templatePart struct {
+	literal string
+	field   string // The name of the placeholder, without braces.
+	env     string // For "env:NAME" placeholders, NAME.
+}
+
+// A nameTemplate is a parsed -log_file_template or -log_link_template.
+type nameTemplate struct {
+	text   string
+	parts  []templatePart
+	depth  int  // The number of subdirectories in expanded names.
+	hasSeq bool // Whether the template contains {seq}.
+}
+
+// parseTemplate parses text as a log file name template, or, if link is true,
+// as a symlink name template.
+//
+// Templates are relative paths using '/' as the separator, and must contain
+// {tag} so that each severity gets its own file.  File templates must also
+// contain {seq}, or every time placeholder down to {ss}, so that a new file
+// never reuses the name of an earlier one: files are rotated at most once a
+// second, and only {seq} moves on to another name when one is taken.  Link templates must be a single file name, and
+// may not contain placeholders whose value changes between files.
+func parseTemplate(text string, link bool) (*nameTemplate, error) {
+	t := &nameTemplate{text: text}
+	hasTag := false
+	times := make(map[string]bool) // The time placeholders in text.
+	for rest := text; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if close := strings.IndexByte(rest, '}'); close >= 0 && (open < 0 || close < open) {
+			return nil, fmt.Errorf("unmatched '}' in log name template %q", text)
+		}
+		if open < 0 {
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:open]})
+		}
+		close := strings.IndexByte(rest[open:], '}')
+		if close < 0 {
+			return nil, fmt.Errorf("unmatched '{' in log name template %q", text)
+		}
+		field := rest[open+1 : open+close]
+		rest = rest[open+close+1:]
+
+		p := templatePart{field: field}
+		switch {
+		case field == "tag":
+			hasTag = true
+		case field == "program", field == "host", field == "user":
+		case field == "pid":
+		case field == "seq":
+			t.hasSeq = true
+		case timeFields[field] > 0:
+			times[field] = true
+		case strings.HasPrefix(field, "env:") && len(field) > len("env:"):
+			p.env = field[len("env:"):]
+		default:
+			return nil, fmt.Errorf("unknown placeholder {%s} in log name template %q", field, text)
+		}
+		if link && (field == "seq" || timeFields[field] > 0) {
+			return nil, fmt.Errorf("placeholder {%s} not allowed in log link template %q", field, text)
+		}
+		t.parts = append(t.parts, p)
+	}
+	if !hasTag {
+		return nil, fmt.Errorf("log name template %q must contain {tag}", text)
+	}
+	if !link && !t.hasSeq && len(times) < len(timeFields) {
+		return nil, fmt.Errorf("log file template %q must contain {seq}, or all of {YYYY}, {MM}, {DD}, {hh}, {mm} and {ss}, so that new log files get new names", text)
+	}
+
+	if strings.HasPrefix(text, "/") || filepath.IsAbs(text) {
+		return nil, fmt.Errorf("log name template %q must be a relative path", text)
+	}
+	elems := strings.Split(text, "/")
+	if link && len(elems) > 1 {
+		return nil, fmt.Errorf("log link template %q must not contain '/'", text)
+	}
+	for _, e := range elems {
+		if e == "" || e == "." || e == ".." {
+			return nil, fmt.Errorf("invalid path element %q in log name template %q", e, text)
+		}
+	}
+	t.depth = len(elems) - 1
+	return t, nil
+}
+
+// mustParseTemplate is like parseTemplate but panics on error.
+func mustParseTemplate(text string, link bool) *nameTemplate {
+	t, err := parseTemplate(text, link)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// sanitizePathElement replaces the path separators in s, so that the values
+// of placeholders cannot add subdirectories.
+func sanitizePathElement(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == filepath.Separator {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// expand returns the name for the log file containing tag, with start time
+// now and sequence number seq.  The name uses the OS path separator.
+func (t *nameTemplate) expand(tag string, now time.Time, seq int) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(p.literal)
+		case "program":
+			b.WriteString(program)
+		case "host":
+			b.WriteString(host)
+		case "user":
+			b.WriteString(userName)
+		case "tag":
+			b.WriteString(tag)
+		case "pid":
+			b.WriteString(strconv.Itoa(pid))
+		case "seq":
+			b.WriteString(strconv.Itoa(seq))
+		case "YYYY":
+			fmt.Fprintf(&b, "%04d", now.Year())
+		case "MM":
+			fmt.Fprintf(&b, "%02d", now.Month())
+		case "DD":
+			fmt.Fprintf(&b, "%02d", now.Day())
+		case "hh":
+			fmt.Fprintf(&b, "%02d", now.Hour())
+		case "mm":
+			fmt.Fprintf(&b, "%02d", now.Minute())
+		case "ss":
+			fmt.Fprintf(&b, "%02d", now.Second())
+		default:
+			b.WriteString(sanitizePathElement(os.Getenv(p.env)))
+		}
+	}
+	return filepath.FromSlash(b.String())
+}
+
+// matcher returns a regexp matching the '/'-separated names, relative to the
+// log directory, of the files expanded from t by this program, running on this
+// host as this user, with any start time, pid and sequence number.  The name
+// may be followed by an extension, such as the one added by compression.  The
+// submatch named "tag" is the tag of the file.
+func (t *nameTemplate) matcher() *regexp.Regexp {
+	return regexp.MustCompile("^" + t.pattern() + `(?:\.[^/]+)?$`)
+}
+
+// pattern returns the regular expression for the names matched by matcher,
+// without anchors or extension.
+func (t *nameTemplate) pattern() string {
+	var b strings.Builder
+	hasTag := false
+	for _, p := range t.parts {
+		switch p.field {
+		case "":
+			b.WriteString(regexp.QuoteMeta(p.literal))
+		case "program":
+			b.WriteString(regexp.QuoteMeta(program))
+		case "host":
+			b.WriteString(regexp.QuoteMeta(host))
+		case "user":
+			b.WriteString(regexp.QuoteMeta(userName))
+		case "tag":
+			if !hasTag {
+				b.WriteString("(?P<tag>")
+				hasTag = true
+			} else {
+				b.WriteString("(?:")
+			}
+			b.WriteString("INFO|WARNING|ERROR|FATAL)")
+		case "pid", "seq":
+			b.WriteString(`\d+`)
+		default:
+			if w := timeFields[p.field]; w > 0 {
+				fmt.Fprintf(&b, `\d{%d}`, w)
+			} else {
+				b.WriteString(regexp.QuoteMeta(sanitizePathElement(os.Getenv(p.env))))
+			}
+		}
+	}
+	return b.String()
+}
+
+// sameNames reports whether the link template link may expand to the name of a
+// file expanded from the file template file, in which case updating the
+// symlink would replace the log file.
+func sameNames(file, link *nameTemplate) bool {
+	re := regexp.MustCompile("^" + file.pattern() + "$")
+	for _, tag := range []string{"INFO", "WARNING", "ERROR", "FATAL"} {
+		if re.MatchString(filepath.ToSlash(link.expand(tag, time.Time{}, 0))) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFlag is a flag.Value implementation for -log_file_template and
+// -log_link_template.
+type templateFlag struct {
+	link bool
+	def  *nameTemplate
+	t    atomic.Pointer[nameTemplate]
+}
+
+// get returns the template, the default one if none has been set.
+func (f *templateFlag) get() *nameTemplate {
+	if t := f.t.Load(); t != nil {
+		return t
+	}
+	return f.def
+}
+
+func (f *templateFlag) String() string {
+	if f.def == nil { // The zero value, as used by flag.isZeroValue.
+		return ""
+	}
+	return f.get().text
+}
+
+func (f *templateFlag) Get() any { return f.get().text }
+
+func (f *templateFlag) Set(value string) error {
+	if value == "" {
+		f.t.Store(nil)
+		return nil
+	}
+	t, err := parseTemplate(value, f.link)
+	if err != nil {
+		return err
+	}
+	if f.link && sameNames(fileTemplate.get(), t) || !f.link && sameNames(t, linkTemplate.get()) {
+		return fmt.Errorf("log name template %q would name symlinks like log files", value)
+	}
+	f.t.Store(t)
+	return nil
+}
+
+var (
+	fileTemplate = templateFlag{def: mustParseTemplate(defaultFileTemplate, false)}            // The -log_file_template flag.
+	linkTemplate = templateFlag{link: true, def: mustParseTemplate(defaultLinkTemplate, true)} // The -log_link_template flag.
+)
+
+func init() {
+	flag.Var(&fileTemplate, glogFlag("log_file_template"), "template for the names of log files, relative to the log directory, with placeholders {program}, {host}, {user}, {tag}, {YYYY}, {MM}, {DD}, {hh}, {mm}, {ss}, {pid}, {seq} and {env:NAME}")
+	flag.Var(&linkTemplate, glogFlag("log_link_template"), "template for the names of the symlinks to the latest log files, with placeholders {program}, {host}, {user}, {tag}, {pid} and {env:NAME}")
+}
+
+// logSeqs holds the next {seq} value for each tag.
+var logSeqs struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+// nextSeq returns the next {seq} value for tag: the number of log files
+// previously named for it.
+func nextSeq(tag string) int {
+	logSeqs.mu.Lock()
+	defer logSeqs.mu.Unlock()
+	if logSeqs.next == nil {
+		logSeqs.next = make(map[string]int)
+	}
+	seq := logSeqs.next[tag]
+	logSeqs.next[tag]++
+	return seq
+}
@@ -0,0 +1,160 @@
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTemplates sets -log_file_template and -log_link_template for the duration
+// of a test.
+func setTemplates(t *testing.T, file, link string) {
+	t.Helper()
+	oldFile, oldLink := fileTemplate.t.Load(), linkTemplate.t.Load()
+	t.Cleanup(func() {
+		fileTemplate.t.Store(oldFile)
+		linkTemplate.t.Store(oldLink)
+	})
+	if err := fileTemplate.Set(file); err != nil {
+		t.Fatalf("fileTemplate.Set(%q): %v", file, err)
+	}
+	if err := linkTemplate.Set(link); err != nil {
+		t.Fatalf("linkTemplate.Set(%q): %v", link, err)
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		link bool
+	}{
+		{text: "{program}.log"},
+		{text: "{program}.{tag"},
+		{text: "{program}}.{tag}"},
+		{text: "{program}.{tga}"},
+		{text: "{env:}.{tag}"},
+		{text: "/var/log/{tag}"},
+		{text: "{YYYY}//{tag}"},
+		{text: "../{tag}"},
+		{text: "{program}.{tag}"},
+		{text: "{program}.{host}.{tag}.{env:HOME}"},
+		{text: "{program}.{tag}.{pid}"},
+		{text: "{program}.{tag}.{YYYY}{MM}{DD}.{pid}"},
+		{text: "{program}.{tag}.{hh}{mm}{ss}"},
+		{text: "{program}.{tag}.{ss}", link: true},
+		{text: "{program}.{tag}.{seq}", link: true},
+		{text: "links/{program}.{tag}", link: true},
+	} {
+		if _, err := parseTemplate(tc.text, tc.link); err == nil {
+			t.Errorf("parseTemplate(%q, %v) succeeded, want error", tc.text, tc.link)
+		}
+	}
+	if err := flag.Lookup("log_file_template").Value.Set("{program}.log"); err == nil {
+		t.Errorf("-log_file_template={program}.log accepted, want error")
+	}
+}
+
+func TestTemplatesNamingTheSameFile(t *testing.T) {
+	for _, tc := range []struct{ file, link string }{
+		{file: "{program}.{tag}.{pid}.{seq}", link: "{program}.{tag}.{pid}.0"},
+		{file: "{program}.{tag}.{YYYY}{MM}{DD}{hh}{mm}{ss}", link: "{program}.{tag}.20240102030405"},
+		{file: "{program}.{seq}.{tag}", link: "{program}.0.{tag}"},
+	} {
+		setTemplates(t, "", "")
+		if err := fileTemplate.Set(tc.file); err != nil {
+			t.Fatalf("fileTemplate.Set(%q): %v", tc.file, err)
+		}
+		if err := linkTemplate.Set(tc.link); err == nil {
+			t.Errorf("-log_link_template=%q accepted with -log_file_template=%q, want error", tc.link, tc.file)
+		}
+
+		setTemplates(t, "", tc.link)
+		if err := fileTemplate.Set(tc.file); err == nil {
+			t.Errorf("-log_file_template=%q accepted with -log_link_template=%q, want error", tc.file, tc.link)
+		}
+	}
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	name, link := logName("INFO", now, 7)
+	want := fmt.Sprintf("%s.%s.%s.log.INFO.20240102-030405.%d", program, host, userName, pid)
+	if name != want {
+		t.Errorf("logName() = %q, want %q", name, want)
+	}
+	if want := program + ".INFO"; link != want {
+		t.Errorf("logName() link = %q, want %q", link, want)
+	}
+}
+
+func TestFileTemplate(t *testing.T) {
+	t.Setenv("GLOG_TEST_INSTANCE", "a/b")
+	setTemplates(t, "{YYYY}-{MM}-{DD}/{program}.{env:GLOG_TEST_INSTANCE}.{tag}.{hh}{mm}.{seq}", "{env:GLOG_TEST_INSTANCE}.{tag}")
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+
+	// Two files created in the same minute get different sequence numbers.
+	var names []string
+	for i := 0; i < 2; i++ {
+		f, name, err := create("WARNING", now, dir)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		f.Close()
+		names = append(names, name)
+	}
+	prefix := filepath.Join(dir, "2024-01-02", program+".a_b.WARNING.0304.")
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			t.Errorf("created %q, want a name starting with %q", name, prefix)
+		}
+	}
+	if names[0] == names[1] {
+		t.Errorf("created %q twice", names[0])
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, "a_b.WARNING"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Join(dir, target); got != names[1] {
+		t.Errorf("symlink points to %q, want %q", got, names[1])
+	}
+	if got := logRoot(names[0]); got != dir {
+		t.Errorf("logRoot(%q) = %q, want %q", names[0], got, dir)
+	}
+}
+
+func TestCleanLogDirTemplate(t *testing.T) {
+	setTemplates(t, "{YYYY}{MM}{DD}/{program}.{tag}.{hh}{mm}{ss}", "")
+	setRetention(t, 1, 0, 0)
+	dir := t.TempDir()
+	var paths []string
+	for i, day := range []int{1, 2} {
+		modTime := time.Now().Add(-time.Duration(2-i) * time.Hour)
+		name, _ := logName("INFO", time.Date(2024, 1, day, 0, 0, 0, 0, time.Local), 0)
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	cleanLogDir(dir)
+	if _, err := os.Stat(filepath.Dir(paths[0])); !os.IsNotExist(err) {
+		t.Errorf("os.Stat(%s) = %v, want the oldest file and its directory removed", filepath.Dir(paths[0]), err)
+	}
+	if _, err := os.Stat(paths[1]); err != nil {
+		t.Errorf("newest file: %v", err)
+	}
+}
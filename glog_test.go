@@ -3,6 +3,7 @@ package glog
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -285,6 +286,39 @@ func TestWarning(t *testing.T) {
 	}
 }
 
+func TestFileSeverities(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	defer logFileSeverities.Set("")
+	defer func(previous bool) { oneOutput = previous }(oneOutput)
+
+	if err := flag.Lookup("log_file_severities").Value.Set("info, ERROR"); err != nil {
+		t.Fatal(err)
+	}
+	for _, one := range []bool{false, true} {
+		oneOutput = one
+		sinks.file.resetBuffers()
+		Warning("warning entry")
+		Error("error entry")
+		if got := contents(logsink.Warning); got != "" {
+			t.Errorf("-one_output=%v: WARNING file has %q, want nothing", one, got)
+		}
+		if !contains(logsink.Error, "error entry", t) || contains(logsink.Error, "warning entry", t) {
+			t.Errorf("-one_output=%v: ERROR file has %q, want only the ERROR entry", one, contents(logsink.Error))
+		}
+		if !contains(logsink.Info, "warning entry", t) {
+			t.Errorf("-one_output=%v: INFO file has %q, want the WARNING entry", one, contents(logsink.Info))
+		}
+		if got := contains(logsink.Info, "error entry", t); got == one {
+			t.Errorf("-one_output=%v: INFO file has %q, want the ERROR entry: %v", one, contents(logsink.Info), !one)
+		}
+	}
+
+	if err := flag.Lookup("log_file_severities").Value.Set("INFO,DEBUG"); err == nil {
+		t.Error("-log_file_severities=INFO,DEBUG accepted, want error")
+	}
+}
+
 // Test that a V log goes to Info.
 func TestV(t *testing.T) {
 	setFlags()
@@ -783,3 +817,35 @@ func TestCreateFailsIfExists(t *testing.T) {
 		t.Errorf("create() succeeded on second call, want error")
 	}
 }
+
+// Test that -log_format=json writes one JSON object per entry.
+func TestJSONLogFormat(t *testing.T) {
+	setFlags()
+	defer sinks.file.swap(sinks.file.newBuffers())
+	if err := flag.Lookup("log_format").Value.Set("json"); err != nil {
+		t.Fatalf("Failed to set -log_format=json: %v", err)
+	}
+	defer flag.Lookup("log_format").Value.Set("glog")
+
+	InfoS("json test", "k", 1)
+	var entry struct {
+		Severity string
+		File     string
+		Message  string
+		Fields   map[string]int
+	}
+	if err := json.Unmarshal([]byte(contents(logsink.Info)), &entry); err != nil {
+		t.Fatalf("json.Unmarshal(%q) failed: %v", contents(logsink.Info), err)
+	}
+	if entry.Severity != "INFO" || entry.File != "glog_test.go" || entry.Message != "json test" || entry.Fields["k"] != 1 {
+		t.Errorf("JSON entry = %+v, want INFO entry from glog_test.go with message %q and field k=1", entry, "json test")
+	}
+
+	var header map[string]any
+	if err := json.Unmarshal(fileHeader(time.Now(), "<none>"), &header); err != nil {
+		t.Fatalf("json.Unmarshal(fileHeader()) failed: %v", err)
+	}
+	if got, want := header["previous_log"], "<none>"; got != want {
+		t.Errorf("JSON file header previous_log = %v, want %q", got, want)
+	}
+}
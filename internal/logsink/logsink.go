@@ -18,10 +18,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/golang/glog/internal/stackdump"
 )
@@ -104,6 +107,15 @@ type Meta struct {
 	// will be set to the process ID (PID), since Go doesn't have threads.
 	Thread int64
 
+	// KeysAndValues holds the key/value pairs passed to a structured logging
+	// call (such as glog.InfoS), as alternating keys and values.  It is nil for
+	// calls that only take a format and arguments.
+	//
+	// The message passed to Printf does not include these pairs: Structured
+	// sinks receive them only here, and Text sinks receive them rendered as
+	// ` key="value"` after the message.
+	KeysAndValues []any
+
 	// Stack trace starting in the logging function. May be nil.
 	// A logsink should implement the StackWanter interface to request this.
 	//
@@ -141,7 +153,8 @@ type StackWanter interface {
 }
 
 // Text is a logging destination that accepts pre-formatted log lines (instead of
-// structured data).
+// structured data).  Lines are encoded by the global Formatter unless the sink
+// implements CustomFormatter.
 type Text interface {
 	// Enabled returns whether this sink should output messages for the given
 	// Meta.  If the sink returns false for a given Meta, the Printf function will
@@ -161,21 +174,116 @@ type Text interface {
 	// NOTE: When developing a text sink, keep in mind the surface in which the
 	// logs will be displayed, and whether it's important that the sink be
 	// resistent to tampering in the style of b/211428300. Standard text sinks
-	// (like `stderrSink`) do not protect against this (e.g. by escaping
-	// characters) because the cases where they would show user-influenced bytes
-	// are vanishingly small.
+	// (like `stderrSink`) do not protect against this by default because the
+	// cases where they would show user-influenced bytes are vanishingly small;
+	// SetEscapeControlChars makes Printf escape control characters in the
+	// messages passed to all Text sinks.
 	Emit(*Meta, []byte) (n int, err error)
 }
 
-// bufs is a pool of *bytes.Buffer used in formatting log entries.
+// A Formatter encodes log entries for Text sinks.
+//
+// Formatters are compared with == so that entries are encoded only once for
+// all sinks that use the same Formatter; use comparable types (such as
+// pointers or empty structs) to benefit from this.
+type Formatter interface {
+	// Format writes the complete entry for the logging call described by m,
+	// including any header and the trailing newline, to buf.
+	//
+	// msg is the message formatted from the format string and arguments.  It
+	// does not include m.KeysAndValues, nor a backtrace requested for the entry
+	// (which is passed in m.Stack instead).
+	//
+	// Format must not modify m or retain m or msg after it returns.
+	Format(buf *bytes.Buffer, m *Meta, msg []byte)
+}
+
+// CustomFormatter can be implemented by a Text sink to choose the Formatter
+// for the entries passed to its Emit method.
+type CustomFormatter interface {
+	// Formatter returns the Formatter for the entry described by meta, or nil
+	// to use the global Formatter (see SetFormatter).
+	Formatter(meta *Meta) Formatter
+}
+
+// The built-in Formatters.
+var (
+	// GlogFormatter encodes entries in the classic glog text format: a header
+	// of the form "Lmmdd hh:mm:ss.uuuuuu PID file:line] " followed by the
+	// message, any key/value pairs and any backtrace.
+	GlogFormatter Formatter = glogFormatter{}
+
+	// JSONFormatter encodes each entry as a JSON object on a single line.
+	JSONFormatter Formatter = jsonFormatter{}
+)
+
+// formatter holds the global Formatter, set with SetFormatter.
+var formatter atomic.Pointer[Formatter]
+
+// SetFormatter sets the Formatter used for Text sinks that don't choose their
+// own (see CustomFormatter).  A nil f restores GlogFormatter.
+func SetFormatter(f Formatter) {
+	if f == nil {
+		formatter.Store(nil)
+		return
+	}
+	formatter.Store(&f)
+}
+
+// GetFormatter returns the Formatter set with SetFormatter, or GlogFormatter
+// if none has been set.
+func GetFormatter() Formatter {
+	if f := formatter.Load(); f != nil {
+		return *f
+	}
+	return GlogFormatter
+}
+
+// textFormatter returns the Formatter that s wants for the entry described by m.
+func textFormatter(s Text, m *Meta) Formatter {
+	if cf, ok := s.(CustomFormatter); ok {
+		if f := cf.Formatter(m); f != nil {
+			return f
+		}
+	}
+	return GetFormatter()
+}
+
+// sameFormatter reports whether a and b are the same Formatter, without
+// panicking if they are not comparable.
+func sameFormatter(a, b Formatter) bool {
+	return reflect.TypeOf(a).Comparable() && a == b
+}
+
+// bufs is a pool of *bytes.Buffer used in encoding log entries.
 var bufs sync.Pool // Pool of *bytes.Buffer.
 
-// textPrintf formats a text log entry and emits it to all specified Text sinks.
+// msgBufs is a pool of *bytes.Buffer used in formatting log messages.  It is
+// separate from bufs so that a message is never formatted over the bytes of an
+// entry that a sink still refers to after Emit has returned.
+var msgBufs sync.Pool // Pool of *bytes.Buffer.
+
+// getBuffer returns an empty *bytes.Buffer from pool, allocating a new one if
+// necessary.
+func getBuffer(pool *sync.Pool) *bytes.Buffer {
+	if bufi := pool.Get(); bufi != nil {
+		buf := bufi.(*bytes.Buffer)
+		buf.Reset()
+		return buf
+	}
+	return bytes.NewBuffer(nil)
+}
+
+// textPrintf formats a text log entry and emits it to all specified Text sinks
+// (textSinks followed by extraSinks).
+//
+// The message is formatted once, then encoded once for each Format wanted by
+// the sinks.
 //
 // The returned n is the maximum across all Emit calls.
 // The returned err is the first non-nil error encountered.
 // Sinks that are disabled by configuration should return (0, nil).
-func textPrintf(m *Meta, textSinks []Text, format string, args ...any) (n int, err error) {
+func textPrintf(m *Meta, textSinks, extraSinks []Text, format string, args ...any) (n int, err error) {
 	// We expect at most file, stderr, and perhaps syslog.  If there are more,
 	// we'll end up allocating - no big deal.
 	const maxExpectedTextSinks = 3
@@ -183,7 +291,12 @@ func textPrintf(m *Meta, textSinks []Text, format string, args ...any) (n int, e
 
 	sinks := noAllocSinks[:0]
 	for _, s := range textSinks {
-		if s.Enabled(m) {
+		if s.Enabled(m) && !isDisabled(s, m) {
+			sinks = append(sinks, s)
+		}
+	}
+	for _, s := range extraSinks {
+		if s.Enabled(m) && !isDisabled(s, m) {
 			sinks = append(sinks, s)
 		}
 	}
@@ -191,16 +304,155 @@ func textPrintf(m *Meta, textSinks []Text, format string, args ...any) (n int, e
 		return 0, nil // No TextSinks specified; don't bother formatting.
 	}
 
-	bufi := bufs.Get()
-	var buf *bytes.Buffer
-	if bufi == nil {
-		buf = bytes.NewBuffer(nil)
-		bufi = buf
-	} else {
-		buf = bufi.(*bytes.Buffer)
+	// Format the message once, separately from any backtrace, which Formatters
+	// find in m.Stack.
+	msgBuf := getBuffer(&msgBufs)
+	format, args, stack := SplitStack(format, args)
+	fmt.Fprintf(msgBuf, format, args...)
+	msg := msgBuf.Bytes()
+	if EscapingControlChars() {
+		escaped := getBuffer(&msgBufs)
+		escapeMessage(escaped, msg)
+		msgBufs.Put(msgBuf)
+		msgBuf, msg = escaped, escaped.Bytes()
+	}
+	if stack != nil && m.Stack == nil {
+		m.Stack = stack
+	}
+
+	// Encode the entry once per distinct Formatter.
+	type encoding struct {
+		f   Formatter
+		buf *bytes.Buffer
+	}
+	var noAllocEncodings [2]encoding
+	encodings := noAllocEncodings[:0]
+	encode := func(f Formatter) []byte {
+		for _, e := range encodings {
+			if sameFormatter(e.f, f) {
+				return e.buf.Bytes()
+			}
+		}
+		buf := getBuffer(&bufs)
+		f.Format(buf, m, msg)
+		applyMultilineMode(buf, f, m, msg)
+		encodings = append(encodings, encoding{f, buf})
+		return buf.Bytes()
+	}
+
+	for _, s := range sinks {
+		sn, sErr := s.Emit(m, encode(textFormatter(s, m)))
+		if sn > n {
+			n = sn
+		}
+		if sErr != nil {
+			err = appendSinkError(err, s, sErr)
+		}
+	}
+
+	if m.Severity == Fatal {
+		// Save the message as it appears in the glog format, regardless of the
+		// Formatters in use.  The buffer is retained by fatalMessage.
+		buf := getBuffer(&bufs)
+		msgStart, msgEnd := writeGlogEntry(buf, m, msg)
+		savedM := *m
+		fatalMessageStore(savedEntry{
+			meta: &savedM,
+			msg:  buf.Bytes()[msgStart:msgEnd],
+		})
+	}
+	msgBufs.Put(msgBuf)
+	for _, e := range encodings {
+		bufs.Put(e.buf)
+	}
+	return n, err
+}
+
+// A MultilineMode selects how Text sinks receive entries that span several
+// lines, such as those with a backtrace.
+type MultilineMode int32
+
+const (
+	// MultilineRaw passes entries through unchanged: only the first line has
+	// a header.
+	MultilineRaw MultilineMode = iota
+	// MultilinePrefix encodes each line as a separate entry, so that every line
+	// has a header.
+	MultilinePrefix
+	// MultilineEscape replaces the newlines within each entry with the two
+	// characters `\n`, so that every entry is a single line.
+	MultilineEscape
+)
+
+// multilineMode holds the MultilineMode set with SetMultilineMode.
+var multilineMode atomic.Int32
+
+// SetMultilineMode sets the MultilineMode for all Text sinks.
+func SetMultilineMode(mode MultilineMode) {
+	multilineMode.Store(int32(mode))
+}
+
+// GetMultilineMode returns the MultilineMode set with SetMultilineMode.
+func GetMultilineMode() MultilineMode {
+	return MultilineMode(multilineMode.Load())
+}
+
+// applyMultilineMode re-encodes the entry in buf, encoded by f from m and msg,
+// according to the MultilineMode if it spans several lines.
+func applyMultilineMode(buf *bytes.Buffer, f Formatter, m *Meta, msg []byte) {
+	mode := GetMultilineMode()
+	if mode == MultilineRaw {
+		return
+	}
+	entry := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	if bytes.IndexByte(entry, '\n') < 0 {
+		return
+	}
+
+	switch mode {
+	case MultilineEscape:
+		escaped := bytes.ReplaceAll(entry, []byte("\n"), []byte(`\n`))
 		buf.Reset()
+		buf.Write(escaped)
+		buf.WriteByte('\n')
+
+	case MultilinePrefix:
+		// Encode each line of the message, then of the backtrace, as an entry of
+		// its own.  The key/value pairs follow the last line of the message, as
+		// they would in a single entry.
+		buf.Reset()
+		lm := *m
+		lm.Stack = nil
+		lm.KeysAndValues = nil
+		lines := bytes.Split(bytes.TrimSuffix(msg, []byte("\n")), []byte("\n"))
+		for i, line := range lines {
+			if i == len(lines)-1 {
+				lm.KeysAndValues = m.KeysAndValues
+			}
+			f.Format(buf, &lm, line)
+		}
+		if m.Stack != nil {
+			lm.KeysAndValues = nil
+			stack := strings.TrimSuffix(m.Stack.String(), "\n")
+			for _, line := range strings.Split(stack, "\n") {
+				f.Format(buf, &lm, []byte(line))
+			}
+		}
 	}
+}
+
+// glogFormatter is the Formatter for the classic glog text format.
+type glogFormatter struct{}
+
+// Format implements Formatter.Format.
+func (glogFormatter) Format(buf *bytes.Buffer, m *Meta, msg []byte) {
+	writeGlogEntry(buf, m, msg)
+}
 
+// writeGlogEntry writes the entry for m and msg to buf in the classic glog
+// text format, and returns the bounds of the message (including any key/value
+// pairs and backtrace) within buf.
+func writeGlogEntry(buf *bytes.Buffer, m *Meta, msg []byte) (msgStart, msgEnd int) {
 	// Lmmdd hh:mm:ss.uuuuuu PID/GID file:line]
 	//
 	// The "PID" entry arguably ought to be TID for consistency with other
@@ -229,13 +481,7 @@ func textPrintf(m *Meta, textSinks []Text, format string, args ...any) (n int, e
 	nDigits(buf, 7, uint64(m.Thread), ' ')
 	buf.WriteByte(' ')
 
-	{
-		file := m.File
-		if i := strings.LastIndex(file, "/"); i >= 0 {
-			file = file[i+1:]
-		}
-		buf.WriteString(file)
-	}
+	buf.WriteString(baseName(m.File))
 
 	buf.WriteByte(':')
 	{
@@ -244,36 +490,151 @@ func textPrintf(m *Meta, textSinks []Text, format string, args ...any) (n int, e
 	}
 	buf.WriteString("] ")
 
-	msgStart := buf.Len()
-	fmt.Fprintf(buf, format, args...)
+	msgStart = buf.Len()
+	buf.Write(msg)
+	if len(m.KeysAndValues) > 0 {
+		if b := buf.Bytes(); len(b) > msgStart && b[len(b)-1] == '\n' {
+			buf.Truncate(buf.Len() - 1)
+		}
+		writeKeysAndValues(buf, m.KeysAndValues)
+	}
+	if m.Stack != nil {
+		fmt.Fprintf(buf, stackSuffix, *m.Stack)
+	}
 	if buf.Len() > MaxLogMessageLen-1 {
 		buf.Truncate(MaxLogMessageLen - 1)
 	}
-	msgEnd := buf.Len()
+	msgEnd = buf.Len()
 	if b := buf.Bytes(); b[len(b)-1] != '\n' {
 		buf.WriteByte('\n')
 	}
+	return msgStart, msgEnd
+}
 
-	for _, s := range sinks {
-		sn, sErr := s.Emit(m, buf.Bytes())
-		if sn > n {
-			n = sn
+// baseName returns the final element of the slash-separated path file.
+func baseName(file string) string {
+	if i := strings.LastIndex(file, "/"); i >= 0 {
+		return file[i+1:]
+	}
+	return file
+}
+
+// stackSuffix is the format suffix with which the glog package appends a
+// backtrace (passed as a trailing stackdump.Stack argument) to a log message.
+const stackSuffix = "\n\n%v\n"
+
+// SplitStack returns format and args without a backtrace appended in the manner
+// of stackSuffix, and the backtrace itself.  If there is no such backtrace, it
+// returns format and args unchanged and a nil stack.
+//
+// Structured sinks receive the format and args with any backtrace still
+// appended; those that report the backtrace separately can use SplitStack to
+// keep it out of the message.
+func SplitStack(format string, args []any) (string, []any, *stackdump.Stack) {
+	if len(args) == 0 || !strings.HasSuffix(format, stackSuffix) {
+		return format, args, nil
+	}
+	stack, ok := args[len(args)-1].(stackdump.Stack)
+	if !ok {
+		return format, args, nil
+	}
+	return strings.TrimSuffix(format, stackSuffix), args[:len(args)-1], &stack
+}
+
+// writeKeysAndValues writes the alternating keys and values in kv to buf as
+// ` key=value` pairs.  String-like values are quoted; a missing final value is
+// written as (MISSING).
+func writeKeysAndValues(buf *bytes.Buffer, kv []any) {
+	if EscapingControlChars() {
+		start := buf.Len()
+		defer func() {
+			written := append([]byte(nil), buf.Bytes()[start:]...)
+			buf.Truncate(start)
+			writeEscaped(buf, written)
+		}()
+	}
+	for i := 0; i < len(kv); i += 2 {
+		buf.WriteByte(' ')
+		if k, ok := kv[i].(string); ok {
+			buf.WriteString(k)
+		} else {
+			fmt.Fprint(buf, kv[i])
+		}
+		buf.WriteByte('=')
+		if i+1 == len(kv) {
+			buf.WriteString("(MISSING)")
+			break
 		}
-		if sErr != nil && err == nil {
-			err = sErr
+		var tmp [64]byte
+		switch v := kv[i+1].(type) {
+		case string:
+			buf.Write(strconv.AppendQuote(tmp[:0], v))
+		case []byte:
+			buf.Write(strconv.AppendQuote(tmp[:0], string(v)))
+		case error, fmt.Stringer:
+			// fmt.Sprint recovers from panics in nil receivers.
+			buf.Write(strconv.AppendQuote(tmp[:0], fmt.Sprint(v)))
+		default:
+			fmt.Fprintf(buf, "%+v", v)
 		}
 	}
+}
 
-	if m.Severity == Fatal {
-		savedM := *m
-		fatalMessageStore(savedEntry{
-			meta: &savedM,
-			msg:  buf.Bytes()[msgStart:msgEnd],
-		})
-	} else {
-		bufs.Put(bufi)
+// escapeControlChars is set with SetEscapeControlChars.
+var escapeControlChars atomic.Bool
+
+// SetEscapeControlChars sets whether the messages and key/value pairs passed
+// to Text sinks have control characters escaped, so that user-influenced bytes
+// in a message can neither forge additional log entries nor send escape
+// sequences to a terminal.
+//
+// When enabled, C0 and C1 control characters (including newlines within the
+// message, but not tabs or the newline ending it), DEL, Unicode bidirectional
+// formatting characters and bytes that are not valid UTF-8 are replaced by Go
+// escape sequences such as \x1b, \r, \n or \u202e.  Backtraces and headers
+// are not affected.
+func SetEscapeControlChars(enabled bool) {
+	escapeControlChars.Store(enabled)
+}
+
+// EscapingControlChars reports whether SetEscapeControlChars is enabled.
+func EscapingControlChars() bool {
+	return escapeControlChars.Load()
+}
+
+// escapeMessage writes msg to dst with control characters escaped, except for
+// a trailing newline.
+func escapeMessage(dst *bytes.Buffer, msg []byte) {
+	trimmed := bytes.TrimSuffix(msg, []byte("\n"))
+	writeEscaped(dst, trimmed)
+	if len(trimmed) < len(msg) {
+		dst.WriteByte('\n')
+	}
+}
+
+// writeEscaped writes b to buf, escaping the characters described by
+// SetEscapeControlChars.
+func writeEscaped(buf *bytes.Buffer, b []byte) {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		switch {
+		case r == '\t':
+			buf.WriteByte('\t')
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f || (r == utf8.RuneError && size == 1):
+			buf.WriteString(`\x`)
+			buf.WriteByte(hex[b[0]>>4])
+			buf.WriteByte(hex[b[0]&0xF])
+		case (r >= 0x80 && r <= 0x9f) || (r >= 0x202a && r <= 0x202e) || (r >= 0x2066 && r <= 0x2069):
+			fmt.Fprintf(buf, `\u%04x`, r)
+		default:
+			buf.Write(b[:size])
+		}
+		b = b[size:]
 	}
-	return n, err
 }
 
 const digits = "0123456789"
@@ -303,38 +664,47 @@ func nDigits(buf *bytes.Buffer, n int, d uint64, pad byte) {
 }
 
 // Printf writes a log entry to all registered TextSinks in this package, then
-// to all registered StructuredSinks.
+// to all registered StructuredSinks.  Sinks added with RegisterText and
+// RegisterStructured follow those in TextSinks and StructuredSinks,
+// respectively.
 //
 // The returned n is the maximum across all Emit and Printf calls.
-// The returned err is the first non-nil error encountered.
-// Sinks that are disabled by configuration should return (0, nil).
+// The returned err holds a *SinkError for each sink that returned an error
+// (see SinkErrors).  Sinks that are disabled by configuration should return
+// (0, nil).  Sinks disabled with Disable are skipped.
 func Printf(m *Meta, format string, args ...any) (n int, err error) {
 	m.Depth++
-	n, err = textPrintf(m, TextSinks, format, args...)
-
-	for _, sink := range StructuredSinks {
-		// TODO: Support TextSinks that implement StackWanter?
-		if sw, ok := sink.(StackWanter); ok && sw.WantStack(m) {
-			if m.Stack == nil {
-				// First, try to find a stacktrace in args, otherwise generate one.
-				for _, arg := range args {
-					if stack, ok := arg.(stackdump.Stack); ok {
+	reg := registered.Load()
+	n, err = textPrintf(m, TextSinks, reg.textSinks(), format, args...)
+
+	for _, sinks := range [...][]Structured{StructuredSinks, reg.structuredSinks()} {
+		for _, sink := range sinks {
+			if isDisabled(sink, m) {
+				continue
+			}
+			// TODO: Support TextSinks that implement StackWanter?
+			if sw, ok := sink.(StackWanter); ok && sw.WantStack(m) {
+				if m.Stack == nil {
+					// First, try to find a stacktrace in args, otherwise generate one.
+					for _, arg := range args {
+						if stack, ok := arg.(stackdump.Stack); ok {
+							m.Stack = &stack
+							break
+						}
+					}
+					if m.Stack == nil {
+						stack := stackdump.Caller( /* skipDepth = */ m.Depth)
 						m.Stack = &stack
-						break
 					}
 				}
-				if m.Stack == nil {
-					stack := stackdump.Caller( /* skipDepth = */ m.Depth)
-					m.Stack = &stack
-				}
 			}
-		}
-		sn, sErr := sink.Printf(m, format, args...)
-		if sn > n {
-			n = sn
-		}
-		if sErr != nil && err == nil {
-			err = sErr
+			sn, sErr := sink.Printf(m, format, args...)
+			if sn > n {
+				n = sn
+			}
+			if sErr != nil {
+				err = appendSinkError(err, sink, sErr)
+			}
 		}
 	}
 	return n, err
@@ -343,6 +713,8 @@ func Printf(m *Meta, format string, args ...any) (n int, err error) {
 // The sets of sinks to which logs should be written.
 //
 // These must only be modified during package init, and are read-only thereafter.
+// To add or remove a sink at any other time, use RegisterStructured,
+// RegisterText and Unregister.
 var (
 	// StructuredSinks is the set of Structured sink instances to which logs
 	// should be written.
@@ -359,6 +731,110 @@ var (
 	TextSinks []Text
 )
 
+// A Registration identifies a sink added with RegisterStructured or
+// RegisterText.  It is passed to Unregister to remove the sink.
+type Registration struct {
+	structured Structured
+	text       Text
+}
+
+// registry is an immutable snapshot of the sinks added with
+// RegisterStructured and RegisterText.  Updates replace the whole snapshot
+// (copy-on-write) so that Printf never observes a partial update.
+type registry struct {
+	regs       []*Registration
+	structured []Structured
+	text       []Text
+}
+
+func (r *registry) structuredSinks() []Structured {
+	if r == nil {
+		return nil
+	}
+	return r.structured
+}
+
+func (r *registry) textSinks() []Text {
+	if r == nil {
+		return nil
+	}
+	return r.text
+}
+
+var (
+	registryMu sync.Mutex // Serializes updates to registered.
+	registered atomic.Pointer[registry]
+)
+
+// updateRegistry replaces the current registry with one holding the
+// registrations returned by f.  f is passed a copy of the current
+// registrations, which it may modify.
+func updateRegistry(f func(regs []*Registration) []*Registration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	var regs []*Registration
+	if old := registered.Load(); old != nil {
+		regs = append(regs, old.regs...)
+	}
+	next := &registry{regs: f(regs)}
+	for _, r := range next.regs {
+		if r.structured != nil {
+			next.structured = append(next.structured, r.structured)
+		} else {
+			next.text = append(next.text, r.text)
+		}
+	}
+	registered.Store(next)
+}
+
+// RegisterStructured adds s to the set of Structured sinks to which logs are
+// written.  Unlike StructuredSinks, it may be called at any time, including
+// concurrently with Printf.  If s is nil, RegisterStructured does nothing and
+// returns nil.
+func RegisterStructured(s Structured) *Registration {
+	if s == nil {
+		return nil
+	}
+	r := &Registration{structured: s}
+	updateRegistry(func(regs []*Registration) []*Registration { return append(regs, r) })
+	return r
+}
+
+// RegisterText adds s to the set of Text sinks to which logs are written.
+// Unlike TextSinks, it may be called at any time, including concurrently with
+// Printf.  If s is nil, RegisterText does nothing and returns nil.
+func RegisterText(s Text) *Registration {
+	if s == nil {
+		return nil
+	}
+	r := &Registration{text: s}
+	updateRegistry(func(regs []*Registration) []*Registration { return append(regs, r) })
+	return r
+}
+
+// Unregister removes the sink identified by r.  It reports whether the sink
+// was registered.
+//
+// A Printf call that is already in progress may still write to the sink after
+// Unregister returns.
+func Unregister(r *Registration) bool {
+	if r == nil {
+		return false
+	}
+	found := false
+	updateRegistry(func(regs []*Registration) []*Registration {
+		for i, reg := range regs {
+			if reg == r {
+				found = true
+				return append(regs[:i], regs[i+1:]...)
+			}
+		}
+		return regs
+	})
+	return found
+}
+
 type savedEntry struct {
 	meta *Meta
 	msg  []byte
@@ -389,5 +865,5 @@ type StructuredTextWrapper struct {
 
 // Printf forwards logs to all Text sinks registered in the StructuredTextWrapper.
 func (w *StructuredTextWrapper) Printf(meta *Meta, format string, args ...any) (n int, err error) {
-	return textPrintf(meta, w.TextSinks, format, args...)
+	return textPrintf(meta, w.TextSinks, nil, format, args...)
 }
@@ -0,0 +1,169 @@
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsink
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A SinkError is an error returned by a sink, as returned by Printf.
+//
+// If more than one sink fails, Printf returns the SinkErrors joined with
+// JoinErrors.
+type SinkError struct {
+	Sink any // The Structured or Text sink that returned Err.
+	Err  error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("log sink %T: %v", e.Sink, e.Err)
+}
+
+func (e *SinkError) Unwrap() error { return e.Err }
+
+// SinkErrors returns the SinkErrors in err, as returned by Printf.
+func SinkErrors(err error) []*SinkError {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case *SinkError:
+		return []*SinkError{err}
+	case interface{ Unwrap() []error }:
+		var errs []*SinkError
+		for _, e := range err.Unwrap() {
+			errs = append(errs, SinkErrors(e)...)
+		}
+		return errs
+	}
+	var se *SinkError
+	if errors.As(err, &se) {
+		return []*SinkError{se}
+	}
+	return nil
+}
+
+// appendSinkError adds the error sErr returned by sink to err.
+func appendSinkError(err error, sink any, sErr error) error {
+	se := &SinkError{Sink: sink, Err: sErr}
+	if err == nil {
+		return se
+	}
+	return JoinErrors(err, se)
+}
+
+// joinedErrors is an error wrapping several errors, as returned by JoinErrors.
+type joinedErrors []error
+
+func (e joinedErrors) Error() string {
+	var b strings.Builder
+	for i, err := range e {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (e joinedErrors) Unwrap() []error { return e }
+
+// JoinErrors returns an error that wraps the non-nil errs, or nil if there are
+// none.  It is equivalent to errors.Join, which requires Go 1.20.
+func JoinErrors(errs ...error) error {
+	var joined joinedErrors
+	for _, err := range errs {
+		if err != nil {
+			joined = append(joined, err)
+		}
+	}
+	if len(joined) == 0 {
+		return nil
+	}
+	return joined
+}
+
+// disabledMu serializes changes to disabled.
+var disabledMu sync.Mutex
+
+// disabled maps each disabled sink to the time until which it is disabled
+// (the zero time for a sink disabled indefinitely).  The map is replaced, never
+// modified, so that logging calls can read it without locking.
+var disabled atomic.Pointer[map[any]time.Time]
+
+// Disable stops Printf from writing to sink until the time until, or
+// indefinitely if until is zero.  It reports false if sink cannot be disabled
+// because its dynamic type is not comparable.
+func Disable(sink any, until time.Time) bool {
+	if !reflect.TypeOf(sink).Comparable() {
+		return false
+	}
+	disabledMu.Lock()
+	defer disabledMu.Unlock()
+	m := make(map[any]time.Time)
+	if old := disabled.Load(); old != nil {
+		for s, t := range *old {
+			m[s] = t
+		}
+	}
+	m[sink] = until
+	disabled.Store(&m)
+	return true
+}
+
+// Enable undoes Disable.
+func Enable(sink any) {
+	if !reflect.TypeOf(sink).Comparable() {
+		return
+	}
+	disabledMu.Lock()
+	defer disabledMu.Unlock()
+	old := disabled.Load()
+	if old == nil {
+		return
+	}
+	if _, ok := (*old)[sink]; !ok {
+		return
+	}
+	var m map[any]time.Time
+	if len(*old) > 1 {
+		m = make(map[any]time.Time)
+		for s, t := range *old {
+			if s != sink {
+				m[s] = t
+			}
+		}
+	}
+	if m == nil {
+		disabled.Store(nil)
+	} else {
+		disabled.Store(&m)
+	}
+}
+
+// isDisabled reports whether sink is disabled for the entry described by m.
+func isDisabled(sink any, m *Meta) bool {
+	d := disabled.Load()
+	if d == nil || !reflect.TypeOf(sink).Comparable() {
+		return false
+	}
+	until, ok := (*d)[sink]
+	return ok && (until.IsZero() || m.Time.Before(until))
+}
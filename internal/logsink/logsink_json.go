@@ -0,0 +1,166 @@
+// Copyright 2023 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// jsonFormatter is the Formatter that encodes entries as JSON.
+type jsonFormatter struct{}
+
+// Format implements Formatter.Format.
+func (jsonFormatter) Format(buf *bytes.Buffer, m *Meta, msg []byte) {
+	writeJSONEntry(buf, m, msg)
+}
+
+// writeJSONEntry writes the entry for m and msg to buf as a JSON object:
+//
+//	{"time":"2006-01-02T15:04:05.999999999Z07:00","severity":"INFO","pid":1234,
+//	 "file":"file.go","line":42,"message":"msg","verbose":true,
+//	 "stack":"...","fields":{"key":"value"}}
+//
+// all on a single line.  The verbose, stack and fields members are omitted if
+// empty.
+func writeJSONEntry(buf *bytes.Buffer, m *Meta, msg []byte) {
+	var tmp [64]byte
+
+	buf.WriteString(`{"time":"`)
+	buf.Write(m.Time.AppendFormat(tmp[:0], time.RFC3339Nano))
+	buf.WriteString(`","severity":"`)
+	buf.WriteString(m.Severity.String())
+	buf.WriteString(`","pid":`)
+	buf.Write(strconv.AppendInt(tmp[:0], m.Thread, 10))
+	buf.WriteString(`,"file":`)
+	writeJSONString(buf, baseName(m.File))
+	buf.WriteString(`,"line":`)
+	buf.Write(strconv.AppendInt(tmp[:0], int64(m.Line), 10))
+
+	// The text encoding ends messages with a newline if they don't already have
+	// one, so a single trailing newline carries no information.
+	msg = bytes.TrimSuffix(msg, []byte("\n"))
+	if len(msg) > MaxLogMessageLen {
+		msg = msg[:MaxLogMessageLen]
+	}
+	buf.WriteString(`,"message":`)
+	writeJSONString(buf, string(msg))
+
+	if m.Verbose {
+		buf.WriteString(`,"verbose":true`)
+	}
+	if m.Stack != nil {
+		buf.WriteString(`,"stack":`)
+		writeJSONString(buf, m.Stack.String())
+	}
+	if kv := m.KeysAndValues; len(kv) > 0 {
+		buf.WriteString(`,"fields":{`)
+		for i := 0; i < len(kv); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if k, ok := kv[i].(string); ok {
+				writeJSONString(buf, k)
+			} else {
+				writeJSONString(buf, fmt.Sprint(kv[i]))
+			}
+			buf.WriteByte(':')
+			if i+1 == len(kv) {
+				buf.WriteString(`"(MISSING)"`)
+				break
+			}
+			writeJSONValue(buf, kv[i+1])
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteString("}\n")
+}
+
+// writeJSONValue writes v to buf as a JSON value.  Values that cannot be
+// marshaled are written as strings, as are errors, fmt.Stringers and []byte
+// (for consistency with the text encoding).
+func writeJSONValue(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		writeJSONString(buf, v)
+		return
+	case []byte:
+		writeJSONString(buf, string(v))
+		return
+	case error, fmt.Stringer:
+		if _, ok := v.(json.Marshaler); !ok {
+			// fmt.Sprint recovers from panics in nil receivers.
+			writeJSONString(buf, fmt.Sprint(v))
+			return
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeJSONString(buf, fmt.Sprintf("%+v", v))
+		return
+	}
+	buf.Write(b)
+}
+
+const hex = "0123456789abcdef"
+
+// writeJSONString writes s to buf as a JSON string, replacing invalid UTF-8
+// with U+FFFD.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+			buf.WriteString(s[start:i])
+			switch b {
+			case '"', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(b)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[b>>4])
+				buf.WriteByte(hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\ufffd`)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
@@ -2,11 +2,14 @@ package logsink_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
 	"reflect"
 	"runtime"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -627,3 +630,358 @@ func (s *fakeTextSink) Emit(meta *logsink.Meta, bytes []byte) (n int, err error)
 	s.calls++
 	return s.byteCount, s.err
 }
+
+func TestRegister(t *testing.T) {
+	originalTextSinks := logsink.TextSinks
+	originalStructuredSinks := logsink.StructuredSinks
+	defer func() {
+		logsink.TextSinks = originalTextSinks
+		logsink.StructuredSinks = originalStructuredSinks
+	}()
+	logsink.TextSinks = nil
+	logsink.StructuredSinks = nil
+
+	text := &fakeTextSink{enabled: true}
+	structured := &fakeStructuredSink{}
+	textReg := logsink.RegisterText(text)
+	structuredReg := logsink.RegisterStructured(structured)
+
+	meta := logsink.Meta{Severity: logsink.Info, Time: time.Unix(1545321163, 0)}
+	m := meta
+	if _, err := logsink.Printf(&m, "test %d", 1); err != nil {
+		t.Fatalf("logsink.Printf() = _, %v", err)
+	}
+	if text.calls != 1 || structured.calls != 1 {
+		t.Errorf("after Printf: text.calls = %d, structured.calls = %d, want 1, 1", text.calls, structured.calls)
+	}
+
+	if !logsink.Unregister(textReg) {
+		t.Errorf("logsink.Unregister(text) = false, want true")
+	}
+	if logsink.Unregister(textReg) {
+		t.Errorf("second logsink.Unregister(text) = true, want false")
+	}
+	m = meta
+	logsink.Printf(&m, "test %d", 2)
+	if text.calls != 1 || structured.calls != 2 {
+		t.Errorf("after Unregister(text): text.calls = %d, structured.calls = %d, want 1, 2", text.calls, structured.calls)
+	}
+
+	logsink.Unregister(structuredReg)
+	m = meta
+	logsink.Printf(&m, "test %d", 3)
+	if structured.calls != 2 {
+		t.Errorf("after Unregister(structured): structured.calls = %d, want 2", structured.calls)
+	}
+}
+
+func TestRegisterNil(t *testing.T) {
+	originalTextSinks := logsink.TextSinks
+	defer func() { logsink.TextSinks = originalTextSinks }()
+	text := &fakeTextSink{enabled: true}
+	logsink.TextSinks = []logsink.Text{text}
+
+	if r := logsink.RegisterText(nil); r != nil {
+		t.Errorf("logsink.RegisterText(nil) = %v, want nil", r)
+	}
+	if r := logsink.RegisterStructured(nil); r != nil {
+		t.Errorf("logsink.RegisterStructured(nil) = %v, want nil", r)
+	}
+	if logsink.Unregister(nil) {
+		t.Errorf("logsink.Unregister(nil) = true, want false")
+	}
+
+	m := logsink.Meta{Severity: logsink.Info, Time: time.Unix(1545321163, 0)}
+	if _, err := logsink.Printf(&m, "test %d", 1); err != nil {
+		t.Fatalf("logsink.Printf() = _, %v", err)
+	}
+	if text.calls != 1 {
+		t.Errorf("text.calls = %d after Printf, want 1", text.calls)
+	}
+}
+
+func TestKeysAndValues(t *testing.T) {
+	originalTextSinks := logsink.TextSinks
+	defer func() { logsink.TextSinks = originalTextSinks }()
+	var sink savingTextSink
+	logsink.TextSinks = []logsink.Text{&sink}
+
+	stack := stackdump.Caller(0)
+	for _, test := range []struct {
+		name   string
+		format string
+		args   []any
+		kv     []any
+		want   string
+	}{
+		{
+			name:   "no pairs",
+			format: "msg",
+			want:   "] msg\n",
+		},
+		{
+			name:   "typed values",
+			format: "%s",
+			args:   []any{"msg"},
+			kv:     []any{"s", "a\"b", "i", 1, "b", []byte("x"), 7, nil, "odd"},
+			want:   `] msg s="a\"b" i=1 b="x" 7=<nil> odd=(MISSING)` + "\n",
+		},
+		{
+			name:   "trailing newline in message",
+			format: "msg\n",
+			kv:     []any{"k", "v"},
+			want:   "] msg k=\"v\"\n",
+		},
+		{
+			name:   "backtrace after pairs",
+			format: "%s\n\n%v\n",
+			args:   []any{"msg", stack},
+			kv:     []any{"k", "v"},
+			want:   "] msg k=\"v\"\n\n" + stack.String() + "\n",
+		},
+	} {
+		meta := &logsink.Meta{
+			Time:          time.Now(),
+			File:          "file.go",
+			Line:          1,
+			Severity:      logsink.Info,
+			KeysAndValues: test.kv,
+		}
+		logsink.Printf(meta, test.format, test.args...)
+		if !bytes.HasSuffix(sink.data, []byte(test.want)) {
+			t.Errorf("%s: got %q, want suffix %q", test.name, sink.data, test.want)
+		}
+	}
+}
+
+// A formatterTextSink is a savingTextSink that wants entries encoded by f.
+type formatterTextSink struct {
+	savingTextSink
+	f logsink.Formatter
+}
+
+func (s *formatterTextSink) Formatter(*logsink.Meta) logsink.Formatter { return s.f }
+
+func TestJSONFormat(t *testing.T) {
+	originalTextSinks := logsink.TextSinks
+	defer func() { logsink.TextSinks = originalTextSinks }()
+	var text savingTextSink
+	js := formatterTextSink{f: logsink.JSONFormatter}
+	logsink.TextSinks = []logsink.Text{&text, &js}
+
+	stack := stackdump.Caller(0)
+	meta := &logsink.Meta{
+		Time:          time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC),
+		File:          "path/to/file.go",
+		Line:          42,
+		Severity:      logsink.Warning,
+		Verbose:       true,
+		Thread:        1234,
+		KeysAndValues: []any{"s", "v", "n", 1.5, "err", errors.New("oops")},
+	}
+	logsink.Printf(meta, "hello \"%s\"\n\n%v\n", "world\x1b", stack)
+
+	if !bytes.HasSuffix(js.data, []byte("}\n")) || bytes.Count(js.data, []byte("\n")) != 1 {
+		t.Fatalf("JSON entry is not a single line: %q", js.data)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(js.data, &got); err != nil {
+		t.Fatalf("json.Unmarshal(%q) failed: %v", js.data, err)
+	}
+	want := map[string]any{
+		"time":     "2024-05-06T07:08:09.123456789Z",
+		"severity": "WARNING",
+		"pid":      1234.0,
+		"file":     "file.go",
+		"line":     42.0,
+		"message":  "hello \"world\x1b\"",
+		"verbose":  true,
+		"stack":    stack.String(),
+		"fields":   map[string]any{"s": "v", "n": 1.5, "err": "oops"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("JSON entry diff -want +got:\n%s", diff)
+	}
+
+	// The text sink still receives the classic format.
+	if !bytes.HasPrefix(text.data, []byte("W0506 07:08:09.123456    1234 file.go:42] hello")) {
+		t.Errorf("text entry = %q, want classic glog format", text.data)
+	}
+}
+
+// A countingFormatter writes "<severity char>: msg\n" and counts its calls.
+type countingFormatter struct{ calls int }
+
+func (f *countingFormatter) Format(buf *bytes.Buffer, m *logsink.Meta, msg []byte) {
+	f.calls++
+	fmt.Fprintf(buf, "%c: %s\n", m.Severity.String()[0], msg)
+}
+
+// An uncomparableFormatter panics if compared with ==.
+type uncomparableFormatter struct{ prefix []byte }
+
+func (f uncomparableFormatter) Format(buf *bytes.Buffer, m *logsink.Meta, msg []byte) {
+	buf.Write(f.prefix)
+	buf.Write(msg)
+	buf.WriteByte('\n')
+}
+
+func TestFormatter(t *testing.T) {
+	originalTextSinks := logsink.TextSinks
+	defer func() { logsink.TextSinks = originalTextSinks }()
+	defer logsink.SetFormatter(nil)
+
+	short := &countingFormatter{}
+	var plain savingTextSink
+	a := formatterTextSink{f: short}
+	b := formatterTextSink{f: short}
+	c := formatterTextSink{f: uncomparableFormatter{[]byte("> ")}}
+	d := formatterTextSink{f: uncomparableFormatter{[]byte("> ")}}
+	logsink.TextSinks = []logsink.Text{&plain, &a, &b, &c, &d}
+
+	meta := &logsink.Meta{
+		Time:     time.Now(),
+		File:     "file.go",
+		Line:     1,
+		Severity: logsink.Error,
+	}
+	logsink.Printf(meta, "hello %d", 1)
+
+	if short.calls != 1 {
+		t.Errorf("Formatter shared by two sinks called %d times, want 1", short.calls)
+	}
+	for _, s := range []*formatterTextSink{&a, &b} {
+		if got, want := string(s.data), "E: hello 1\n"; got != want {
+			t.Errorf("sink with custom Formatter got %q, want %q", got, want)
+		}
+	}
+	for _, s := range []*formatterTextSink{&c, &d} {
+		if got, want := string(s.data), "> hello 1\n"; got != want {
+			t.Errorf("sink with uncomparable Formatter got %q, want %q", got, want)
+		}
+	}
+	if !bytes.Contains(plain.data, []byte("file.go:1] hello 1\n")) {
+		t.Errorf("sink with default Formatter got %q, want glog format", plain.data)
+	}
+
+	// The global Formatter applies to sinks that don't choose their own.
+	logsink.SetFormatter(short)
+	logsink.Printf(meta, "global")
+	if got, want := string(plain.data), "E: global\n"; got != want {
+		t.Errorf("after SetFormatter, sink got %q, want %q", got, want)
+	}
+	if short.calls != 2 {
+		t.Errorf("Formatter shared by three sinks called %d times in total, want 2", short.calls)
+	}
+}
+
+func TestDisable(t *testing.T) {
+	originalTextSinks := logsink.TextSinks
+	defer func() { logsink.TextSinks = originalTextSinks }()
+	failing := &fakeTextSink{enabled: true, err: errors.New("failed")}
+	working := &fakeTextSink{enabled: true}
+	logsink.TextSinks = []logsink.Text{failing, working}
+
+	now := time.Now()
+	meta := logsink.Meta{Time: now, Severity: logsink.Info}
+	_, err := logsink.Printf(&meta, "test")
+	errs := logsink.SinkErrors(err)
+	if len(errs) != 1 || errs[0].Sink != failing || errs[0].Err != failing.err {
+		t.Fatalf("logsink.SinkErrors(%v) = %v, want one error from the failing sink", err, errs)
+	}
+
+	logsink.Disable(failing, now.Add(time.Second))
+	defer logsink.Enable(failing)
+	meta = logsink.Meta{Time: now, Severity: logsink.Info}
+	if _, err := logsink.Printf(&meta, "test"); err != nil {
+		t.Errorf("logsink.Printf() with failing sink disabled returned %v, want nil", err)
+	}
+	if failing.calls != 1 || working.calls != 2 {
+		t.Errorf("sinks called %d and %d times, want 1 and 2", failing.calls, working.calls)
+	}
+
+	// The sink is enabled again once the time has passed.
+	meta = logsink.Meta{Time: now.Add(time.Second), Severity: logsink.Info}
+	logsink.Printf(&meta, "test")
+	if failing.calls != 2 {
+		t.Errorf("failing sink called %d times after it was re-enabled, want 2", failing.calls)
+	}
+}
+
+func TestMultilineMode(t *testing.T) {
+	originalTextSinks := logsink.TextSinks
+	defer func() { logsink.TextSinks = originalTextSinks }()
+	defer logsink.SetMultilineMode(logsink.MultilineRaw)
+	var text savingTextSink
+	js := formatterTextSink{f: logsink.JSONFormatter}
+	logsink.TextSinks = []logsink.Text{&text, &js}
+
+	const header = "E0506 07:08:09.000000    1234 file.go:42] "
+	for _, test := range []struct {
+		mode logsink.MultilineMode
+		want string
+	}{
+		{
+			mode: logsink.MultilineRaw,
+			want: header + "line 1\nline 2 k=\"v\"\n",
+		},
+		{
+			mode: logsink.MultilinePrefix,
+			want: header + "line 1\n" + header + "line 2 k=\"v\"\n",
+		},
+		{
+			mode: logsink.MultilineEscape,
+			want: header + `line 1\nline 2 k="v"` + "\n",
+		},
+	} {
+		logsink.SetMultilineMode(test.mode)
+		meta := &logsink.Meta{
+			Time:          time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+			File:          "path/to/file.go",
+			Line:          42,
+			Severity:      logsink.Error,
+			Thread:        1234,
+			KeysAndValues: []any{"k", "v"},
+		}
+		logsink.Printf(meta, "line 1\nline %d", 2)
+		if got := string(text.data); got != test.want {
+			t.Errorf("mode %d: got %q, want %q", test.mode, got, test.want)
+		}
+		if got := bytes.Count(js.data, []byte("\n")); got != 1 {
+			t.Errorf("mode %d: JSON entry has %d newlines, want 1: %q", test.mode, got, js.data)
+		}
+	}
+
+	// With MultilinePrefix, every line of a backtrace gets a header too.
+	logsink.SetMultilineMode(logsink.MultilinePrefix)
+	stack := stackdump.Caller(0)
+	meta := &logsink.Meta{Time: time.Now(), File: "file.go", Line: 1, Severity: logsink.Info}
+	logsink.Printf(meta, "msg\n\n%v\n", stack)
+	for _, line := range strings.Split(strings.TrimSuffix(string(text.data), "\n"), "\n") {
+		if !strings.Contains(line, "file.go:1] ") {
+			t.Errorf("line without header in %q", line)
+		}
+	}
+}
+
+func TestEscapeControlChars(t *testing.T) {
+	originalTextSinks := logsink.TextSinks
+	defer func() { logsink.TextSinks = originalTextSinks }()
+	var text savingTextSink
+	logsink.TextSinks = []logsink.Text{&text}
+
+	logsink.SetEscapeControlChars(true)
+	defer logsink.SetEscapeControlChars(false)
+	meta := &logsink.Meta{
+		Time:          time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		File:          "file.go",
+		Line:          1,
+		Severity:      logsink.Info,
+		KeysAndValues: []any{"k\x1b", []any{"\x00"}},
+	}
+	logsink.Printf(meta, "%s\n", "a\tb\r\nI0506 forged\x1b[2J\x00\xff\u0085\u202e")
+	want := `] a	b\r\nI0506 forged\x1b[2J\x00\xff\u0085\u202e k\x1b=[\x00]` + "\n"
+	if !strings.HasSuffix(string(text.data), want) {
+		t.Errorf("got %q, want suffix %q", text.data, want)
+	}
+}